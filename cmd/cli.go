@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/jacky-htg/erp-pkg/db/postgres"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
 	"github.com/jacky-htg/purchase-service/internal/config"
 	"github.com/jacky-htg/purchase-service/internal/schema"
+	"github.com/jacky-htg/purchase-service/internal/service"
+	"github.com/jacky-htg/purchase-service/internal/sheet"
+	"github.com/jacky-htg/purchase-service/internal/tenant"
 	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -33,7 +47,7 @@ func run(log *log.Logger) error {
 	log.Printf("main : Started")
 	defer log.Println("main : Completed")
 
-	db, err := postgres.Open()
+	db, err := tenant.Open()
 	if err != nil {
 		return fmt.Errorf("connecting to db: %v", err)
 	}
@@ -55,7 +69,220 @@ func run(log *log.Logger) error {
 		}
 		log.Println("Seed data complete")
 		return nil
+
+	case "import-suppliers":
+		return importSuppliers(log, db, flag.Args()[1:])
+
+	case "export":
+		return export(log, db, flag.Args()[1:])
+
+	case "backfill-product-snapshots":
+		return backfillProductSnapshots(log, db, flag.Args()[1:])
 	}
 
 	return nil
 }
+
+// importSuppliers run bulk import of suppliers file, ex: cli import-suppliers -company=ID -user=ID [-dry-run] suppliers.xlsx
+func importSuppliers(log *log.Logger, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("import-suppliers", flag.ContinueOnError)
+	companyID := fs.String("company", "", "company id")
+	userID := fs.String("user", "", "user id")
+	format := fs.String("format", "", "file format csv or xlsx, default from file extension")
+	dryRun := fs.Bool("dry-run", false, "validate the file without saving")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*companyID) == 0 || len(*userID) == 0 || fs.NArg() != 1 {
+		return fmt.Errorf("usage: import-suppliers -company=ID -user=ID [-format=csv|xlsx] [-dry-run] FILE")
+	}
+
+	sheetFormat, err := fileFormat(*format, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("open file: %v", err)
+	}
+	defer f.Close()
+
+	supplierService := service.Supplier{Db: db}
+	output, err := supplierService.ImportSuppliers(cliContext(*companyID, *userID), sheetFormat, f, *dryRun)
+	if err != nil {
+		return fmt.Errorf("importing suppliers: %v", err)
+	}
+
+	for _, importError := range output.GetErrors() {
+		log.Printf("row %d %s: %s", importError.GetRow(), importError.GetCode(), importError.GetMessage())
+	}
+	log.Printf("Import suppliers complete, dry run: %t, total: %d, created: %d, updated: %d, failed: %d",
+		output.GetDryRun(), output.GetTotal(), output.GetCreated(), output.GetUpdated(), output.GetFailed())
+
+	return nil
+}
+
+// export write purchases, purchase lines, returns, return lines or suppliers into file,
+// ex: cli export -company=ID -user=ID -entity=purchase-lines -columns=code,product_code,quantity -locale=id-ID purchases.xlsx
+func export(log *log.Logger, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	companyID := fs.String("company", "", "company id")
+	userID := fs.String("user", "", "user id")
+	entity := fs.String("entity", "", "purchases, purchase-lines, purchase-returns, purchase-return-lines or suppliers")
+	format := fs.String("format", "", "file format csv or xlsx, default from file extension")
+	columns := fs.String("columns", "", "comma separated column names, default all columns")
+	locale := fs.String("locale", "", "language tag of number and date format, ex: id-ID, default plain numbers and ISO date")
+	branchID := fs.String("branch", "", "branch id of purchases or returns")
+	supplierID := fs.String("supplier", "", "supplier id of purchases or returns")
+	purchaseID := fs.String("purchase", "", "purchase id of returns")
+	productID := fs.String("product", "", "product id contained in purchases or returns")
+	dateFrom := fs.String("date-from", "", "purchase or return date from, ex: 2024-01-01T00:00:00.000Z")
+	dateTo := fs.String("date-to", "", "purchase or return date to, ex: 2024-01-31T23:59:59.999Z")
+	search := fs.String("search", "", "search text")
+	statuses := fs.String("status", "", "comma separated supplier status, ex: active,blocked")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*companyID) == 0 || len(*userID) == 0 || len(*entity) == 0 || fs.NArg() != 1 {
+		return fmt.Errorf("usage: export -company=ID -user=ID -entity=ENTITY [-format=csv|xlsx] [-columns=a,b] [-locale=TAG] " +
+			"[-branch=ID] [-supplier=ID] [-purchase=ID] [-product=ID] [-date-from=DATE] [-date-to=DATE] [-search=TEXT] [-status=active,inactive,blocked] FILE")
+	}
+
+	sheetFormat, err := fileFormat(*format, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	options := service.ExportOptions{Format: sheetFormat, Locale: *locale}
+	if len(*columns) > 0 {
+		for _, column := range strings.Split(*columns, ",") {
+			options.Columns = append(options.Columns, strings.TrimSpace(column))
+		}
+	}
+
+	pagination := &purchases.Pagination{Search: *search}
+	var write func(ctx context.Context, w io.Writer) error
+	switch *entity {
+	case "purchases", "purchase-lines":
+		in := &purchases.ListPurchaseRequest{Pagination: pagination, BranchId: *branchID, SupplierId: *supplierID,
+			ProductId: *productID, DateFrom: *dateFrom, DateTo: *dateTo}
+		purchaseService := service.Purchase{Db: db}
+		write = func(ctx context.Context, w io.Writer) error {
+			return purchaseService.ExportPurchases(ctx, w, in, *entity == "purchase-lines", options, nil)
+		}
+	case "purchase-returns", "purchase-return-lines":
+		in := &purchases.ListPurchaseReturnRequest{Pagination: pagination, BranchId: *branchID, PurchaseId: *purchaseID,
+			SupplierId: *supplierID, ProductId: *productID, DateFrom: *dateFrom, DateTo: *dateTo}
+		purchaseReturnService := service.PurchaseReturn{Db: db}
+		write = func(ctx context.Context, w io.Writer) error {
+			return purchaseReturnService.ExportPurchaseReturns(ctx, w, in, *entity == "purchase-return-lines", options, nil)
+		}
+	case "suppliers":
+		in := &purchases.ListSupplierRequest{Pagination: pagination}
+		if len(*statuses) > 0 {
+			for _, s := range strings.Split(*statuses, ",") {
+				supplierStatus, ok := purchases.SupplierStatus_value[strings.ToUpper(strings.TrimSpace(s))]
+				if !ok {
+					return fmt.Errorf("invalid status %s", s)
+				}
+				in.Statuses = append(in.Statuses, purchases.SupplierStatus(supplierStatus))
+			}
+		}
+		supplierService := service.Supplier{Db: db}
+		write = func(ctx context.Context, w io.Writer) error {
+			return supplierService.ExportSuppliers(ctx, w, in, options, nil)
+		}
+	default:
+		return fmt.Errorf("invalid entity %s", *entity)
+	}
+
+	f, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("create file: %v", err)
+	}
+	defer f.Close()
+
+	// the file is buffered, the database rows are written as they are read
+	w := bufio.NewWriter(f)
+	if err := write(cliContext(*companyID, *userID), w); err != nil {
+		return fmt.Errorf("exporting %s: %v", *entity, err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write file: %v", err)
+	}
+
+	log.Printf("Export %s complete: %s", *entity, fs.Arg(0))
+	return f.Close()
+}
+
+// fileFormat return the format flag, or guess it from file extension when the flag is empty
+func fileFormat(format string, file string) (sheet.Format, error) {
+	if len(format) == 0 {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+
+	switch strings.ToLower(format) {
+	case "csv":
+		return sheet.CSV, nil
+	case "xlsx":
+		return sheet.XLSX, nil
+	}
+
+	return sheet.CSV, fmt.Errorf("unsupported file format %s", format)
+}
+
+// backfillProductSnapshots fill product code, name and unit of old purchase and return details,
+// ex: CLI_TOKEN=JWT cli backfill-product-snapshots -company=ID -user=ID
+// The token of the user is sent to inventory service, the user is recorded as actor of the audit log.
+func backfillProductSnapshots(log *log.Logger, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("backfill-product-snapshots", flag.ContinueOnError)
+	companyID := fs.String("company", "", "company id")
+	userID := fs.String("user", "", "user id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*companyID) == 0 || len(*userID) == 0 {
+		return fmt.Errorf("usage: CLI_TOKEN=JWT backfill-product-snapshots -company=ID -user=ID")
+	}
+
+	if len(os.Getenv("CLI_TOKEN")) == 0 {
+		return fmt.Errorf("CLI_TOKEN is required to call inventory service")
+	}
+
+	inventoryConn, err := grpc.NewClient(os.Getenv("INVENTORY_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("create inventory service connection: %v", err)
+	}
+	defer inventoryConn.Close()
+
+	purchaseService := service.Purchase{Db: db, ProductClient: inventories.NewProductServiceClient(inventoryConn)}
+	total, missing, err := purchaseService.BackfillProductSnapshots(cliContext(*companyID, *userID))
+	if err != nil {
+		return fmt.Errorf("backfilling product snapshots: %v", err)
+	}
+
+	for _, productID := range missing {
+		log.Printf("product %s is not found in inventory service, its details are left without snapshot", productID)
+	}
+	log.Printf("Backfill product snapshots complete, details: %d, missing products: %d", total, len(missing))
+
+	return nil
+}
+
+// cliContext build context as the grpc metadata do for the service.
+// The token of CLI_TOKEN, when set, authorize the calls to other services.
+func cliContext(companyID, userID string) context.Context {
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), companyID)
+	ctx = context.WithValue(ctx, app.Ctx("userID"), userID)
+	ctx = app.SetMetadata(ctx)
+	if token := os.Getenv("CLI_TOKEN"); len(token) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	return ctx
+}
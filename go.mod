@@ -7,9 +7,13 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.4.0
 	github.com/jacky-htg/erp-pkg v0.0.0-20240801083922-c28d9991b30b
+	// erp-proto must be bumped to the release containing the supplier status, merge, import/export,
+	// scorecard, price report, email, cursor pagination and setting update mask messages used by this service, and go.sum
+	// regenerated with go mod tidy.
 	github.com/jacky-htg/erp-proto v0.0.0-20240801035620-2110e92720fa
 	github.com/lib/pq v1.10.9
 	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.34.2
 )
 
 require (
@@ -19,5 +23,4 @@ require (
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
-	google.golang.org/protobuf v1.34.2 // indirect
 )
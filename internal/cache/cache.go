@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadTimeout limit the load shared by the callers of Do
+const LoadTimeout = 10 * time.Second
+
+// Cache is in-memory TTL cache bounded by number of entries, the least recently used entry is evicted first.
+// Concurrent loads of the same key are de-duplicated, only one loader is called and the others wait for its result.
+type Cache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	inflight map[string]*call
+	// generation is increased by every invalidation, so a load started before it is not cached
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// Stats of the cache usage
+type Stats struct {
+	Hits    int64
+	Misses  int64
+	Size    int
+	HitRate float64
+}
+
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// New create cache, ttl or maxSize less than or equal zero disable the cache
+func New(ttl time.Duration, maxSize int) *Cache {
+	return &Cache{
+		ttl:      ttl,
+		maxSize:  maxSize,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inflight: make(map[string]*call),
+	}
+}
+
+// Get return the value of key when it is cached and not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.get(key)
+}
+
+// Do return the cached value of key or call load and cache its result. Error of load is never cached.
+// The load is shared by concurrent callers, so it run with the values of ctx but not its cancellation,
+// limited by LoadTimeout. Each caller stop waiting when its own ctx is done.
+func (c *Cache) Do(ctx context.Context, key string, load func(context.Context) (interface{}, error)) (interface{}, error) {
+	if c.ttl <= 0 || c.maxSize <= 0 {
+		c.misses.Add(1)
+		return load(ctx)
+	}
+
+	c.mu.Lock()
+	if value, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return value, nil
+	}
+
+	current, ok := c.inflight[key]
+	if !ok {
+		current = &call{done: make(chan struct{})}
+		c.inflight[key] = current
+		go c.load(ctx, key, current, c.generation, load)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-current.done:
+		return current.value, current.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load call the loader of inflight call and cache its result, unless the key is invalidated while loading
+func (c *Cache) load(ctx context.Context, key string, current *call, generation uint64, load func(context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), LoadTimeout)
+	defer cancel()
+
+	current.value, current.err = load(ctx)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if current.err == nil && generation == c.generation {
+		c.set(key, current.value)
+	}
+	c.mu.Unlock()
+	close(current.done)
+}
+
+// Delete remove the key
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// DeletePrefix remove every key starting with prefix
+func (c *Cache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(element)
+		}
+	}
+}
+
+// Flush remove all keys
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Stats return the hit and miss counters since the cache was created
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	size := len(c.entries)
+	c.mu.Unlock()
+
+	stats := Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+
+	return stats
+}
+
+// get must be called with mu held
+func (c *Cache) get(key string) (interface{}, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		c.remove(element)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+	return e.value, true
+}
+
+// set must be called with mu held
+func (c *Cache) set(key string, value interface{}) {
+	expiresAt := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		e.value = value
+		e.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for len(c.entries) > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
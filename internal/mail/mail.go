@@ -0,0 +1,143 @@
+// Package mail send email messages through a pluggable transport.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Transport deliver the message
+type Transport interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Attachment is a file attached to the message
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a plain text email with attachments
+type Message struct {
+	From        string
+	To          []string
+	Cc          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// ValidateSender check the address can be used as sender of the messages, it must be bare address, ex: purchasing@example.com
+func ValidateSender(address string) error {
+	parsed, err := netmail.ParseAddress(address)
+	if err != nil {
+		return fmt.Errorf("invalid mail sender %q: %v", address, err)
+	}
+
+	if parsed.Address != address {
+		return fmt.Errorf("mail sender %q must be bare address", address)
+	}
+
+	return nil
+}
+
+// Recipients return the addresses of To and Cc
+func (m *Message) Recipients() []string {
+	return append(append([]string{}, m.To...), m.Cc...)
+}
+
+// Bytes encode the message in MIME format
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.From) == 0 {
+		return nil, errors.New("mail sender is empty")
+	}
+
+	if len(m.To) == 0 {
+		return nil, errors.New("mail has no recipient")
+	}
+
+	for _, address := range append(m.Recipients(), m.From) {
+		if strings.ContainsAny(address, "\r\n") {
+			return nil, fmt.Errorf("invalid mail address %q", address)
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	if len(m.Cc) > 0 {
+		header("Cc", strings.Join(m.Cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+messageID()+"@purchase-service>")
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/mixed; boundary="`+writer.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, []byte(m.Body))
+
+	for _, attachment := range m.Attachments {
+		contentType := attachment.ContentType
+		if len(contentType) == 0 {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": attachment.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, attachment.Data)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeBase64 write data in lines of 76 characters as required by MIME
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,188 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	"github.com/jacky-htg/purchase-service/internal/mail"
+)
+
+// TestMessageBytes parse the encoded message back and check its headers and parts
+func TestMessageBytes(t *testing.T) {
+	msg := &mail.Message{
+		From:    "purchasing@example.com",
+		To:      []string{"sales@supplier.com", "owner@supplier.com"},
+		Cc:      []string{"finance@example.com"},
+		Subject: "Purchase Order PO-001 – Ä",
+		Body:    strings.Repeat("Please find attached our purchase order. ", 5),
+		Attachments: []mail.Attachment{
+			{Name: "purchase-order-PO-001.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4 test")},
+			{Name: "note.bin", Data: []byte{0, 1, 2}},
+		},
+	}
+
+	b, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	parsed, err := netmail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+
+	headers := map[string]string{
+		"From":         "purchasing@example.com",
+		"To":           "sales@supplier.com, owner@supplier.com",
+		"Cc":           "finance@example.com",
+		"MIME-Version": "1.0",
+	}
+	for key, want := range headers {
+		if got := parsed.Header.Get(key); got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+
+	parts := readParts(t, parsed)
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+
+	if parts[0].body != msg.Body {
+		t.Errorf("body = %q, want %q", parts[0].body, msg.Body)
+	}
+
+	for i, attachment := range msg.Attachments {
+		part := parts[i+1]
+		if part.fileName != attachment.Name {
+			t.Errorf("attachment %d file name = %q, want %q", i, part.fileName, attachment.Name)
+		}
+		if part.body != string(attachment.Data) {
+			t.Errorf("attachment %d content = %q, want %q", i, part.body, attachment.Data)
+		}
+	}
+
+	if parts[2].contentType != "application/octet-stream" {
+		t.Errorf("attachment without content type = %q, want application/octet-stream", parts[2].contentType)
+	}
+
+	for _, line := range strings.Split(string(b), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line longer than 998 characters: %d", len(line))
+		}
+	}
+}
+
+func TestMessageBytesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  mail.Message
+	}{
+		{"no sender", mail.Message{To: []string{"sales@supplier.com"}}},
+		{"no recipient", mail.Message{From: "purchasing@example.com", Cc: []string{"finance@example.com"}}},
+		{"header injection in recipient", mail.Message{From: "purchasing@example.com", To: []string{"sales@supplier.com\r\nBcc: x@y.com"}}},
+		{"header injection in sender", mail.Message{From: "purchasing@example.com\nBcc: x@y.com", To: []string{"sales@supplier.com"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.msg.Bytes(); err == nil {
+				t.Error("Bytes return no error")
+			}
+		})
+	}
+}
+
+func TestValidateSender(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{"purchasing@example.com", true},
+		{"", false},
+		{"purchasing", false},
+		{"Purchasing <purchasing@example.com>", false},
+	}
+
+	for _, tt := range tests {
+		if err := mail.ValidateSender(tt.address); (err == nil) != tt.valid {
+			t.Errorf("ValidateSender(%q) = %v, want valid %v", tt.address, err, tt.valid)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	transport := &mail.Memory{}
+	mailer := &mail.Mailer{Transport: transport, From: "purchasing@example.com"}
+
+	if err := mailer.Send(context.Background(), &mail.Message{To: []string{"sales@supplier.com"}, Subject: "Test"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if err := mailer.Send(context.Background(), &mail.Message{Subject: "No recipient"}); err == nil {
+		t.Error("Send without recipient return no error")
+	}
+
+	sent := transport.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("got %d sent messages, want 1", len(sent))
+	}
+
+	if sent[0].From != "purchasing@example.com" {
+		t.Errorf("sender = %q, want the sender of mailer", sent[0].From)
+	}
+}
+
+type part struct {
+	contentType string
+	fileName    string
+	body        string
+}
+
+// readParts decode the base64 parts of the multipart body of the message
+func readParts(t *testing.T, msg *netmail.Message) []part {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("content type = %q (%v), want multipart/mixed", mediaType, err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+
+	var parts []part
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+
+		if encoding := p.Header.Get("Content-Transfer-Encoding"); encoding != "base64" {
+			t.Errorf("part transfer encoding = %q, want base64", encoding)
+		}
+
+		body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts = append(parts, part{contentType: mediaType, fileName: p.FileName(), body: string(body)})
+	}
+
+	return parts
+}
@@ -0,0 +1,198 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SMTP send the message to SMTP server. STARTTLS is used when the server support it.
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func (t *SMTP) Send(ctx context.Context, msg *Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := t.send(ctx, msg, body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("smtp: %v", err)
+	}
+
+	return nil
+}
+
+// send deliver the message on a connection bounded by the context. net/smtp has no context,
+// so the deadline of the context is set on the connection and the connection is closed when the context is done.
+func (t *SMTP) send(ctx context.Context, msg *Message, body []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.Host, t.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: t.Host}); err != nil {
+			return err
+		}
+	}
+
+	if len(t.Username) > 0 {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("server doesn't support AUTH")
+		}
+		if err := client.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(msg.From); err != nil {
+		return err
+	}
+
+	for _, recipient := range msg.Recipients() {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// Memory keep the sent messages in memory, it is used in tests and development
+type Memory struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (t *Memory) Send(ctx context.Context, msg *Message) error {
+	if _, err := msg.Bytes(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = append(t.sent, *msg)
+
+	return nil
+}
+
+// Sent return copy of the sent messages
+func (t *Memory) Sent() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Message{}, t.sent...)
+}
+
+// File write each message as .eml file into Dir, it is used in development to inspect the messages
+type File struct {
+	Dir string
+}
+
+func (t *File) Send(ctx context.Context, msg *Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.Dir, 0o750); err != nil {
+		return fmt.Errorf("create mail dir: %v", err)
+	}
+
+	name := filepath.Join(t.Dir, time.Now().UTC().Format("20060102T150405.000000000")+"-"+messageID()[:8]+".eml")
+	if err := os.WriteFile(name, body, 0o640); err != nil {
+		return fmt.Errorf("write mail: %v", err)
+	}
+
+	return nil
+}
+
+// NewTransport create the transport by name: "smtp", "file" or "memory"
+func NewTransport(name string) (Transport, error) {
+	switch name {
+	case "smtp":
+		if len(os.Getenv("SMTP_HOST")) == 0 {
+			return nil, errors.New("SMTP_HOST is required by smtp transport")
+		}
+
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTP{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mails"
+		}
+		return &File{Dir: dir}, nil
+	case "memory", "":
+		return &Memory{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %s", name)
+	}
+}
+
+// Mailer send messages from the configured sender address
+type Mailer struct {
+	Transport Transport
+	From      string
+}
+
+// Send fill the sender of the message and send it
+func (m *Mailer) Send(ctx context.Context, msg *Message) error {
+	if len(msg.From) == 0 {
+		msg.From = m.From
+	}
+
+	return m.Transport.Send(ctx, msg)
+}
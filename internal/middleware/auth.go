@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Auth validate the JWT of the caller and check the permission of the called method.
+// It must be chained after Metadata, the user and company of the token replace the ones sent in metadata
+// and the outgoing metadata is rebuilt from them.
+type Auth struct {
+	// Keys is the local key set, HMAC secret by key id
+	Keys       map[string][]byte
+	UserClient users.UserServiceClient
+	// Permissions map full method name to the access required, method not in the map is denied
+	Permissions map[string]string
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	CompanyID string `json:"company_id"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// LoadKeySet read the key set from JSON file in JWKS format, only symmetric ("oct") keys are used
+func LoadKeySet(file string) (map[string][]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read key set: %v", err)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("parse key set: %v", err)
+	}
+
+	keys := make(map[string][]byte)
+	for _, key := range jwks.Keys {
+		if key.Kty != "oct" {
+			continue
+		}
+
+		secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key.K, "="))
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s: %v", key.Kid, err)
+		}
+		keys[key.Kid] = secret
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key set %s has no symmetric key", file)
+	}
+
+	return keys, nil
+}
+
+// Unary interceptor
+func (u *Auth) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := u.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream interceptor
+func (u *Auth) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := u.authorize(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		wrappedStream := &wrappedStream{
+			ServerStream: stream,
+			ctx:          ctx,
+		}
+
+		return handler(srv, wrappedStream)
+	}
+}
+
+func (u *Auth) authorize(ctx context.Context, method string) (context.Context, error) {
+	claims, err := u.verify(bearerToken(ctx))
+	if err != nil {
+		return ctx, err
+	}
+
+	ctx = context.WithValue(ctx, app.Ctx("userID"), claims.Subject)
+	ctx = context.WithValue(ctx, app.Ctx("companyID"), claims.CompanyID)
+	ctx = app.SetMetadata(ctx)
+
+	permission, ok := u.Permissions[method]
+	if !ok {
+		return ctx, status.Errorf(codes.PermissionDenied, "method %s is not allowed", method)
+	}
+
+	userLogin, err := model.GetUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return ctx, err
+	}
+
+	for _, access := range userLogin.GetGroup().GetAccess() {
+		if access.GetName() == permission {
+			return ctx, nil
+		}
+	}
+
+	return ctx, status.Errorf(codes.PermissionDenied, "permission %s is required", permission)
+}
+
+// verify check the signature and the time claims of the token
+func (u *Auth) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(token) == 0 || len(parts) != 3 {
+		return nil, status.Error(codes.Unauthenticated, "Please supply valid token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Please supply valid token")
+	}
+
+	var newHash func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		newHash = sha256.New
+	case "HS384":
+		newHash = sha512.New384
+	case "HS512":
+		newHash = sha512.New
+	default:
+		return nil, status.Errorf(codes.Unauthenticated, "token algorithm %s is not supported", header.Alg)
+	}
+
+	key, ok := u.Keys[header.Kid]
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "token key is unknown")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Please supply valid token")
+	}
+
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, status.Error(codes.Unauthenticated, "invalid token signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Please supply valid token")
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt {
+		return nil, status.Error(codes.Unauthenticated, "token is expired")
+	}
+
+	if claims.NotBefore > 0 && now < claims.NotBefore {
+		return nil, status.Error(codes.Unauthenticated, "token is not valid yet")
+	}
+
+	if len(claims.Subject) == 0 || len(claims.CompanyID) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "token has no user or company")
+	}
+
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// bearerToken read the token of "authorization: Bearer <token>" metadata
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	token := values[0]
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = token[7:]
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/purchase-service/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// IdempotencyHeader is the metadata key sent by the client to make the unary call safe to retry
+const IdempotencyHeader = "idempotency-key"
+
+// DefaultIdempotencyLease is used when the lease of Idempotency is not set
+const DefaultIdempotencyLease = time.Minute
+
+// idempotencyWriteTimeout bound the writes done after the call is handled, they do not use the request deadline
+const idempotencyWriteTimeout = 5 * time.Second
+
+// Idempotency replay the stored response of a unary call retried with the same idempotency key.
+// The key is scoped by company and kept for TTL, the response is only replayed to the user who made the call.
+// Calls without the header are not affected. It must be chained after Auth, because the company and user are read from the context.
+type Idempotency struct {
+	Db  *sql.DB
+	Log *log.Logger
+	TTL time.Duration
+	// Lease is how long a key without response is held by the call in progress. After it the key can be
+	// reclaimed by a retry, so a key left by a crashed call does not block the retries until TTL.
+	// It must be longer than the longest call.
+	Lease time.Duration
+}
+
+// Unary interceptor
+func (u *Idempotency) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		key := idempotencyKey(ctx)
+		if len(key) == 0 {
+			return handler(ctx, req)
+		}
+
+		companyID, ok := ctx.Value(app.Ctx("companyID")).(string)
+		if !ok || len(companyID) == 0 {
+			return handler(ctx, req)
+		}
+
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		userID, _ := ctx.Value(app.Ctx("userID")).(string)
+		hash, err := requestHash(info.FullMethod, userID, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		lockedAt, reserved, err := u.reserve(ctx, companyID, key, info.FullMethod, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reserved {
+			return u.replay(ctx, companyID, key, hash)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			// the call failed, release the key so the client can retry it
+			u.release(ctx, companyID, key, lockedAt)
+			return resp, err
+		}
+
+		// the call is done, a failed save only make the retry run again after the lease
+		if err := u.save(ctx, companyID, key, lockedAt, resp); err != nil {
+			u.Log.Printf("save idempotency key %s of %s: %v", key, info.FullMethod, err)
+		}
+
+		return resp, nil
+	}
+}
+
+// Purge delete the expired keys of every company, so it run under the bypass of the tenant policies
+func (u *Idempotency) Purge(ctx context.Context) error {
+	_, err := u.Db.ExecContext(tenant.Bypass(ctx), `DELETE FROM idempotency_keys WHERE expires_at < $1`, time.Now().UTC())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec purge idempotency keys: %v", err)
+	}
+
+	return nil
+}
+
+// reserve insert the key before the call is handled and return the time it is locked at, false when the key is used.
+// Expired key, or key without response whose lease has passed, is taken over.
+func (u *Idempotency) reserve(ctx context.Context, companyID, key, method, hash string) (time.Time, bool, error) {
+	// the lock time identify the owner of the lease, it is rounded to the precision of the column
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	lease := u.Lease
+	if lease <= 0 {
+		lease = DefaultIdempotencyLease
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (company_id, key, method, request_hash, created_at, expires_at, locked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $5)
+		ON CONFLICT (company_id, key) DO UPDATE SET
+			method = EXCLUDED.method,
+			request_hash = EXCLUDED.request_hash,
+			response_type = NULL,
+			response = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at,
+			locked_at = EXCLUDED.locked_at
+		WHERE idempotency_keys.expires_at < $5
+			OR (idempotency_keys.response IS NULL AND idempotency_keys.locked_at < $7)
+	`
+	result, err := u.Db.ExecContext(ctx, query, companyID, key, method, hash, now, now.Add(u.TTL), now.Add(-lease))
+	if err != nil {
+		return now, false, status.Errorf(codes.Internal, "Exec insert idempotency key: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return now, false, status.Errorf(codes.Internal, "Rows affected: %v", err)
+	}
+
+	return now, affected > 0, nil
+}
+
+// replay return the stored response of the key
+func (u *Idempotency) replay(ctx context.Context, companyID, key, hash string) (interface{}, error) {
+	var requestHash string
+	var responseType sql.NullString
+	var response []byte
+	err := u.Db.QueryRowContext(ctx,
+		`SELECT request_hash, response_type, response FROM idempotency_keys WHERE company_id = $1 AND key = $2`,
+		companyID, key).Scan(&requestHash, &responseType, &response)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.Aborted, "request with the same idempotency key has just failed, please retry")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query Raw get idempotency key: %v", err)
+	}
+
+	if requestHash != hash {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key has been used for a different request")
+	}
+
+	if !responseType.Valid {
+		return nil, status.Error(codes.Aborted, "request with the same idempotency key is still in progress")
+	}
+
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(responseType.String))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "find response type %s: %v", responseType.String, err)
+	}
+
+	resp := messageType.New().Interface()
+	if err := proto.Unmarshal(response, resp); err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal stored response: %v", err)
+	}
+
+	return resp, nil
+}
+
+// save store the response of the handled call, unless the lease has been taken over by a retry.
+// The request context may be already canceled, so it is detached from its cancellation.
+func (u *Idempotency) save(ctx context.Context, companyID, key string, lockedAt time.Time, resp interface{}) error {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "response of type %T can not be stored", resp)
+	}
+
+	response, err := proto.Marshal(msg)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal response: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyWriteTimeout)
+	defer cancel()
+
+	_, err = u.Db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET response_type = $1, response = $2 WHERE company_id = $3 AND key = $4 AND locked_at = $5`,
+		string(msg.ProtoReflect().Descriptor().FullName()), response, companyID, key, lockedAt)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update idempotency key: %v", err)
+	}
+
+	return nil
+}
+
+// release delete the reserved key, unless the lease has been taken over by a retry.
+// The request context may be already canceled, so it is detached from its cancellation,
+// its company is still needed to pass the tenant policy.
+func (u *Idempotency) release(ctx context.Context, companyID, key string, lockedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyWriteTimeout)
+	defer cancel()
+
+	u.Db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE company_id = $1 AND key = $2 AND response IS NULL AND locked_at = $3`,
+		companyID, key, lockedAt)
+}
+
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(IdempotencyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// requestHash identify the payload, the same key must be sent by the same user with the same method and request
+func requestHash(method, userID string, msg proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "marshal request: %v", err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	h.Write([]byte{0})
+	h.Write(b)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
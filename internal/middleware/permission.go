@@ -0,0 +1,63 @@
+package middleware
+
+// Permissions is the access required by each method, checked against the access of the user group.
+var Permissions = map[string]string{
+	"/purchases.PurchaseService/PurchaseCreate":                "purchase:create",
+	"/purchases.PurchaseService/PurchaseUpdate":                "purchase:update",
+	"/purchases.PurchaseService/PurchaseView":                  "purchase:view",
+	"/purchases.PurchaseService/PurchaseList":                  "purchase:view",
+	"/purchases.PurchaseService/PurchaseExport":                "purchase:view",
+	"/purchases.PurchaseService/GetOutstandingPurchaseDetails": "purchase:view",
+	"/purchases.PurchaseService/PurchaseSettingView":           "purchase-setting:view",
+	"/purchases.PurchaseService/PurchaseSettingUpdate":         "purchase-setting:update",
+	"/purchases.PurchaseService/PurchasePdf":                   "purchase:view",
+	"/purchases.PurchaseService/PurchaseEmailSend":             "purchase:email",
+	"/purchases.PurchaseService/PurchaseEmailResend":           "purchase:email",
+	"/purchases.PurchaseService/PurchaseEmailList":             "purchase:view",
+	"/purchases.PurchaseService/DocumentTemplateView":          "document-template:view",
+	"/purchases.PurchaseService/DocumentTemplateUpdate":        "document-template:update",
+
+	"/purchases.PurchaseReturnService/PurchaseReturnCreate": "purchase-return:create",
+	"/purchases.PurchaseReturnService/PurchaseReturnUpdate": "purchase-return:update",
+	"/purchases.PurchaseReturnService/PurchaseReturnView":   "purchase-return:view",
+	"/purchases.PurchaseReturnService/PurchaseReturnList":   "purchase-return:view",
+	"/purchases.PurchaseReturnService/PurchaseReturnExport": "purchase-return:view",
+	"/purchases.PurchaseReturnService/PurchaseReturnPdf":    "purchase-return:view",
+
+	"/purchases.SupplierService/SupplierCreate":             "supplier:create",
+	"/purchases.SupplierService/SupplierUpdate":             "supplier:update",
+	"/purchases.SupplierService/SupplierView":               "supplier:view",
+	"/purchases.SupplierService/SupplierDelete":             "supplier:delete",
+	"/purchases.SupplierService/SupplierList":               "supplier:view",
+	"/purchases.SupplierService/SupplierChangeStatus":       "supplier:update",
+	"/purchases.SupplierService/SupplierContactCreate":      "supplier:update",
+	"/purchases.SupplierService/SupplierContactUpdate":      "supplier:update",
+	"/purchases.SupplierService/SupplierContactDelete":      "supplier:update",
+	"/purchases.SupplierService/SupplierAddressCreate":      "supplier:update",
+	"/purchases.SupplierService/SupplierAddressUpdate":      "supplier:update",
+	"/purchases.SupplierService/SupplierAddressDelete":      "supplier:update",
+	"/purchases.SupplierService/SupplierBankAccountCreate":  "supplier:update",
+	"/purchases.SupplierService/SupplierBankAccountUpdate":  "supplier:update",
+	"/purchases.SupplierService/SupplierBankAccountDelete":  "supplier:update",
+	"/purchases.SupplierService/SupplierBankAccountConfirm": "supplier-bank-account:confirm",
+	"/purchases.SupplierService/SupplierPriceCreate":        "supplier-price:update",
+	"/purchases.SupplierService/SupplierPriceDelete":        "supplier-price:update",
+	"/purchases.SupplierService/SupplierScorecard":          "supplier:view",
+	"/purchases.SupplierService/SupplierRanking":            "supplier:view",
+	"/purchases.SupplierService/SupplierImport":             "supplier:import",
+	"/purchases.SupplierService/SupplierExport":             "supplier:view",
+	"/purchases.SupplierService/SupplierDuplicates":         "supplier:view",
+	"/purchases.SupplierService/SupplierMerge":              "supplier:merge",
+	"/purchases.SupplierService/SupplierDocumentCreate":     "supplier:update",
+	"/purchases.SupplierService/SupplierDocumentUpdate":     "supplier:update",
+	"/purchases.SupplierService/SupplierDocumentDelete":     "supplier:update",
+	"/purchases.SupplierService/SupplierDocumentDownload":   "supplier:view",
+	"/purchases.SupplierService/SupplierDocumentExpiring":   "supplier:view",
+	"/purchases.SupplierService/SupplierBranchesUpdate":     "supplier:update",
+
+	"/purchases.ReportService/SpendReport":   "report:view",
+	"/purchases.ReportService/PriceHistory":  "report:view",
+	"/purchases.ReportService/PriceVariance": "report:view",
+
+	"/purchases.AuditService/AuditLogList": "audit-log:view",
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Audit entities, the name of the table written
+const (
+	AuditSupplier             = "suppliers"
+	AuditPurchase             = "purchases"
+	AuditPurchaseDetail       = "purchase_details"
+	AuditPurchaseReturn       = "purchase_returns"
+	AuditPurchaseReturnDetail = "purchase_return_details"
+)
+
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+)
+
+// AuditLog is append-only history of writes. Before and after are json image of the row.
+type AuditLog struct {
+	Pb purchases.AuditLog
+}
+
+func (u *AuditLog) List(ctx context.Context, db *sql.DB, entity string, entityID string) ([]*purchases.AuditLog, error) {
+	var list []*purchases.AuditLog
+	query := `
+		SELECT id, entity, entity_id, action, actor, created_at, COALESCE(before::text, ''), COALESCE(after::text, '')
+		FROM audit_logs
+		WHERE company_id = $1 AND entity = $2 AND entity_id = $3
+		ORDER BY created_at, id
+	`
+
+	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), entity, entityID)
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list audit log: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pbAuditLog purchases.AuditLog
+		var createdAt time.Time
+		err = rows.Scan(&pbAuditLog.Id, &pbAuditLog.Entity, &pbAuditLog.EntityId, &pbAuditLog.Action, &pbAuditLog.Actor,
+			&createdAt, &pbAuditLog.Before, &pbAuditLog.After)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbAuditLog.CreatedAt = createdAt.String()
+		list = append(list, &pbAuditLog)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+// auditSnapshot read json image of the row, nil when the row does not exist
+func auditSnapshot(ctx context.Context, tx *sql.Tx, entity string, id string) ([]byte, error) {
+	var snapshot []byte
+	err := tx.QueryRowContext(ctx, `SELECT to_jsonb(t) FROM `+entity+` t WHERE t.id = $1`, id).Scan(&snapshot)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, status.Errorf(codes.Internal, "Query snapshot %s: %v", entity, err)
+	}
+
+	return snapshot, nil
+}
+
+// writeAudit insert audit log of the row in the same transaction of the write.
+// The after image is read from the row, so it must be called after the row is written.
+func writeAudit(ctx context.Context, tx *sql.Tx, entity string, id string, action string, before []byte) error {
+	var after []byte
+	if action != auditDelete {
+		var err error
+		after, err = auditSnapshot(ctx, tx, entity, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO audit_logs (id, company_id, entity, entity_id, action, actor, created_at, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := tx.ExecContext(ctx, query,
+		uuid.New().String(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		entity,
+		id,
+		action,
+		ctx.Value(app.Ctx("userID")).(string),
+		time.Now().UTC(),
+		nullJSON(before),
+		nullJSON(after),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert audit log: %v", err)
+	}
+
+	return nil
+}
+
+func nullJSON(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+
+	return string(b)
+}
@@ -26,7 +26,7 @@ func (u *Branch) IsYourBranch(ctx context.Context) error {
 
 	if len(userLogin.GetBranchId()) > 0 {
 		if userLogin.GetBranchId() != u.Id {
-			return status.Error(codes.Unauthenticated, "its not your branch")
+			return status.Error(codes.PermissionDenied, "its not your branch")
 		}
 	} else if len(userLogin.GetRegionId()) > 0 {
 		region, err := getRegion(ctx, u.RegionClient, &users.Region{Id: userLogin.GetRegionId()})
@@ -51,6 +51,48 @@ func (u *Branch) IsYourBranch(ctx context.Context) error {
 	return nil
 }
 
+// BranchScope is the branches and regions a user can access. Nil scope means the user can access all branches of the company.
+type BranchScope struct {
+	BranchIds []string
+	RegionIds []string
+}
+
+// YourScope resolve branches of the user login the same way IsYourBranch does
+func (u *Branch) YourScope(ctx context.Context) (*BranchScope, error) {
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 {
+		u.Id = userLogin.GetBranchId()
+		if err := u.Get(ctx); err != nil {
+			return nil, err
+		}
+
+		scope := &BranchScope{BranchIds: []string{u.Pb.GetId()}}
+		if len(u.Pb.GetRegionId()) > 0 {
+			scope.RegionIds = []string{u.Pb.GetRegionId()}
+		}
+		return scope, nil
+	}
+
+	if len(userLogin.GetRegionId()) > 0 {
+		region, err := getRegion(ctx, u.RegionClient, &users.Region{Id: userLogin.GetRegionId()})
+		if err != nil {
+			return nil, err
+		}
+
+		scope := &BranchScope{RegionIds: []string{region.GetId()}}
+		for _, branch := range region.GetBranches() {
+			scope.BranchIds = append(scope.BranchIds, branch.GetId())
+		}
+		return scope, nil
+	}
+
+	return nil, nil
+}
+
 func checkYourBranch(branches []*users.Branch, branchID string) error {
 	isYourBranch := false
 	for _, branch := range branches {
@@ -61,40 +103,69 @@ func checkYourBranch(branches []*users.Branch, branchID string) error {
 	}
 
 	if !isYourBranch {
-		return status.Error(codes.Unauthenticated, "its not your branch")
+		return status.Error(codes.PermissionDenied, "its not your branch")
 	}
 
 	return nil
 }
 
 func getUserLogin(ctx context.Context, userClient users.UserServiceClient) (*users.User, error) {
-	userLogin, err := userClient.View(ctx, &users.Id{Id: ctx.Value(app.Ctx("userID")).(string)})
-	if s, ok := status.FromError(err); !ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling user.Get service: %s", err)
+	userID := ctx.Value(app.Ctx("userID")).(string)
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	userLogin, err := userCache.Do(ctx, userCacheKey(companyID, "user", userID), func(ctx context.Context) (interface{}, error) {
+		userLogin, err := userClient.View(ctx, &users.Id{Id: userID})
+		if s, ok := status.FromError(err); !ok {
+			if s.Code() == codes.Unknown {
+				err = status.Errorf(codes.Internal, "Error when calling user.Get service: %s", err)
+			}
+
+			return nil, err
 		}
 
+		return userLogin, err
+	})
+	if err != nil {
 		return &users.User{}, err
 	}
 
-	return userLogin, nil
+	return userLogin.(*users.User), nil
 }
 
 func getRegion(ctx context.Context, regionClient users.RegionServiceClient, r *users.Region) (*users.Region, error) {
-	region, err := regionClient.View(ctx, &users.Id{Id: r.GetId()})
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	region, err := userCache.Do(ctx, userCacheKey(companyID, "region", r.GetId()), func(ctx context.Context) (interface{}, error) {
+		region, err := regionClient.View(ctx, &users.Id{Id: r.GetId()})
 
-	if s, ok := status.FromError(err); !ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Region.Get service: %s", err)
+		if s, ok := status.FromError(err); !ok {
+			if s.Code() == codes.Unknown {
+				err = status.Errorf(codes.Internal, "Error when calling Region.Get service: %s", err)
+			}
+
+			return nil, err
 		}
 
+		return region, err
+	})
+	if err != nil {
 		return &users.Region{}, err
 	}
 
-	return region, nil
+	return region.(*users.Region), nil
 }
 
 func getBranches(ctx context.Context, branchClient users.BranchServiceClient) ([]*users.Branch, error) {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	list, err := userCache.Do(ctx, userCacheKey(companyID, "branches", ""), func(ctx context.Context) (interface{}, error) {
+		return listBranches(ctx, branchClient)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list.([]*users.Branch), nil
+}
+
+func listBranches(ctx context.Context, branchClient users.BranchServiceClient) ([]*users.Branch, error) {
 	var list []*users.Branch
 	var err error
 	stream, err := branchClient.List(ctx, &users.ListBranchRequest{})
@@ -121,15 +192,23 @@ func getBranches(ctx context.Context, branchClient users.BranchServiceClient) ([
 }
 
 func (u *Branch) Get(ctx context.Context) error {
-	branch, err := u.BranchClient.View(ctx, &users.Id{Id: u.Id})
-	if s, ok := status.FromError(err); !ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Branch.Get service: %s", err)
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	branch, err := userCache.Do(ctx, userCacheKey(companyID, "branch", u.Id), func(ctx context.Context) (interface{}, error) {
+		branch, err := u.BranchClient.View(ctx, &users.Id{Id: u.Id})
+		if s, ok := status.FromError(err); !ok {
+			if s.Code() == codes.Unknown {
+				err = status.Errorf(codes.Internal, "Error when calling Branch.Get service: %s", err)
+			}
+
+			return nil, err
 		}
 
+		return branch, err
+	})
+	if err != nil {
 		return err
 	}
-	u.Pb = branch
+	u.Pb = branch.(*users.Branch)
 
 	return nil
 }
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DocumentTemplate is the company customization of printed document. Company without saved template print without header and footer text.
+type DocumentTemplate struct {
+	Pb purchases.DocumentTemplate
+	// LogoKey is the key of logo in blob storage, empty when the template has no logo
+	LogoKey string
+}
+
+func (u *DocumentTemplate) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT company_name, company_address, terms, footer, email_subject, email_body, logo_key, updated_at, updated_by
+		FROM document_templates WHERE company_id = $1 AND document_type = $2
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get document template: %v", err)
+	}
+	defer stmt.Close()
+
+	var updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetDocumentType().String()).Scan(
+		&u.Pb.CompanyName, &u.Pb.CompanyAddress, &u.Pb.Terms, &u.Pb.Footer, &u.Pb.EmailSubject, &u.Pb.EmailBody, &u.LogoKey, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		u.Pb = purchases.DocumentTemplate{DocumentType: u.Pb.GetDocumentType()}
+		u.LogoKey = ""
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get document template: %v", err)
+	}
+
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+func (u *DocumentTemplate) Save(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO document_templates (company_id, document_type, company_name, company_address, terms, footer,
+			email_subject, email_body, logo_key, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (company_id, document_type) DO UPDATE SET
+		company_name = EXCLUDED.company_name,
+		company_address = EXCLUDED.company_address,
+		terms = EXCLUDED.terms,
+		footer = EXCLUDED.footer,
+		email_subject = EXCLUDED.email_subject,
+		email_body = EXCLUDED.email_body,
+		logo_key = EXCLUDED.logo_key,
+		updated_at = EXCLUDED.updated_at,
+		updated_by = EXCLUDED.updated_by
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare save document template: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetDocumentType().String(),
+		u.Pb.GetCompanyName(),
+		u.Pb.GetCompanyAddress(),
+		u.Pb.GetTerms(),
+		u.Pb.GetFooter(),
+		u.Pb.GetEmailSubject(),
+		u.Pb.GetEmailBody(),
+		u.LogoKey,
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec save document template: %v", err)
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+// NewLogoKey set the key of the logo in blob storage
+func (u *DocumentTemplate) NewLogoKey(companyID string) {
+	u.LogoKey = companyID + "/document-templates/" + strings.ToLower(u.Pb.GetDocumentType().String()) + "-logo"
+}
+
+// ArchiveKey is the key of printed document in blob storage. Each version of the document is archived in its own file.
+func ArchiveKey(companyID string, documentType purchases.DocumentType, id string, version int32) string {
+	return companyID + "/documents/" + strings.ToLower(documentType.String()) + "/" + id + "-v" + strconv.Itoa(int(version)) + ".pdf"
+}
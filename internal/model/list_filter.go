@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// documentFilter is the filter shared by purchase and purchase return listing, empty values are not filtered.
+// Dates use the input layout and the ranges include both ends.
+type documentFilter struct {
+	// table is the document table, dateColumn is its document date column
+	table      string
+	dateColumn string
+	// detailTable and detailKey is the detail table and its column referencing the document
+	detailTable string
+	detailKey   string
+
+	DateFrom      string
+	DateTo        string
+	CreatedFrom   string
+	CreatedTo     string
+	TotalPriceMin float64
+	TotalPriceMax float64
+	ProductId     string
+	CreatedBy     string
+}
+
+// apply append the conditions of the filter to where, and its values to paramQueries
+func (f *documentFilter) apply(where []string, paramQueries []interface{}) ([]string, []interface{}, error) {
+	ranges := []struct {
+		value    string
+		column   string
+		operator string
+		name     string
+	}{
+		{f.DateFrom, f.dateColumn, ">=", "date from"},
+		{f.DateTo, f.dateColumn, "<=", "date to"},
+		{f.CreatedFrom, "created_at", ">=", "created from"},
+		{f.CreatedTo, "created_at", "<=", "created to"},
+	}
+
+	for _, r := range ranges {
+		if len(r.value) == 0 {
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02T15:04:05.000Z", r.value)
+		if err != nil {
+			return where, paramQueries, status.Errorf(codes.InvalidArgument, "Please supply valid %s", r.name)
+		}
+
+		paramQueries = append(paramQueries, date)
+		where = append(where, fmt.Sprintf(`%s.%s %s $%d`, f.table, r.column, r.operator, len(paramQueries)))
+	}
+
+	if f.TotalPriceMin < 0 || (f.TotalPriceMax > 0 && f.TotalPriceMax < f.TotalPriceMin) {
+		return where, paramQueries, status.Error(codes.InvalidArgument, "Please supply valid total price range")
+	}
+
+	if f.TotalPriceMin > 0 {
+		paramQueries = append(paramQueries, f.TotalPriceMin)
+		where = append(where, fmt.Sprintf(`%s.total_price >= $%d`, f.table, len(paramQueries)))
+	}
+
+	if f.TotalPriceMax > 0 {
+		paramQueries = append(paramQueries, f.TotalPriceMax)
+		where = append(where, fmt.Sprintf(`%s.total_price <= $%d`, f.table, len(paramQueries)))
+	}
+
+	if len(f.ProductId) > 0 {
+		paramQueries = append(paramQueries, f.ProductId)
+		where = append(where, fmt.Sprintf(`EXISTS (SELECT 1 FROM %s WHERE %s.%s = %s.id AND %s.product_id = $%d)`,
+			f.detailTable, f.detailTable, f.detailKey, f.table, f.detailTable, len(paramQueries)))
+	}
+
+	if len(f.CreatedBy) > 0 {
+		paramQueries = append(paramQueries, f.CreatedBy)
+		where = append(where, fmt.Sprintf(`%s.created_by = $%d`, f.table, len(paramQueries)))
+	}
+
+	return where, paramQueries, nil
+}
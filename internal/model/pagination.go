@@ -0,0 +1,240 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sortKey is an expression of ORDER BY
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+// keyset is the ordering of a listing. The last key must be unique, ex: the id, so the order is stable
+// and the cursor of a row point to exactly one position.
+type keyset []sortKey
+
+func (k keyset) orderBy() string {
+	var keys []string
+	for _, key := range k {
+		if key.desc {
+			keys = append(keys, key.expr+" DESC")
+		} else {
+			keys = append(keys, key.expr+" ASC")
+		}
+	}
+
+	return strings.Join(keys, ", ")
+}
+
+// signature identify the ordering, so the cursor of other ordering is rejected
+func (k keyset) signature() string {
+	h := fnv.New32a()
+	h.Write([]byte(k.orderBy()))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// column is the select expression of the row cursor, a json array of the signature and the key values.
+// EncodeCursor turn it into the opaque cursor of response.
+func (k keyset) column() string {
+	exprs := []string{"'" + k.signature() + "'"}
+	for _, key := range k {
+		exprs = append(exprs, key.expr)
+	}
+
+	return "json_build_array(" + strings.Join(exprs, ", ") + ")::text"
+}
+
+// after return the condition of the rows after cursor, the key values of cursor are appended to paramQueries.
+// The keys must not be null.
+func (k keyset) after(cursor string, paramQueries []interface{}) (string, []interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", paramQueries, status.Error(codes.InvalidArgument, "Please supply valid cursor")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil || len(values) != len(k)+1 || values[0] != k.signature() {
+		return "", paramQueries, status.Error(codes.InvalidArgument, "Please supply valid cursor")
+	}
+
+	// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., the comparison is reversed for descending key
+	var params []string
+	for _, value := range values[1:] {
+		switch value := value.(type) {
+		case string:
+			paramQueries = append(paramQueries, value)
+		case json.Number:
+			paramQueries = append(paramQueries, value.String())
+		default:
+			return "", paramQueries, status.Error(codes.InvalidArgument, "Please supply valid cursor")
+		}
+		params = append(params, fmt.Sprintf("$%d", len(paramQueries)))
+	}
+
+	var conditions []string
+	for i, key := range k {
+		var condition []string
+		for j := 0; j < i; j++ {
+			condition = append(condition, fmt.Sprintf("%s = %s", k[j].expr, params[j]))
+		}
+
+		operator := ">"
+		if key.desc {
+			operator = "<"
+		}
+		condition = append(condition, fmt.Sprintf("%s %s %s", key.expr, operator, params[i]))
+		conditions = append(conditions, "("+strings.Join(condition, " AND ")+")")
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", paramQueries, nil
+}
+
+// maxSortFields limit the number of sort keys of a listing
+const maxSortFields = 5
+
+// sortFields is the whitelist of a listing, it map the public field name to its SQL expression.
+// The expressions must not be null, so the cursor can compare them.
+type sortFields struct {
+	fields map[string]string
+	// legacy is the table prefix accepted in OrderBy, ex: purchases.code
+	legacy string
+	// defaultField is used when the pagination has no sort
+	defaultField string
+	// id is the unique expression breaking the tie
+	id string
+}
+
+// keyset return the ordering of pagination. Sorts has precedence over the single OrderBy and Sort.
+// Unknown or repeated field is invalid argument. Rank is the search rank expression, empty when there is no search.
+// With rank, the "rank" field can be sorted and it is the default ordering, the best match first.
+func (f *sortFields) keyset(pagination *purchases.Pagination, rank string) (keyset, error) {
+	fields := f.fields
+	if len(rank) > 0 {
+		fields = map[string]string{"rank": rank}
+		for name, expr := range f.fields {
+			fields[name] = expr
+		}
+	}
+
+	sorts := pagination.GetSorts()
+	if len(sorts) == 0 {
+		field := strings.TrimPrefix(pagination.GetOrderBy(), f.legacy+".")
+		switch {
+		case len(field) > 0:
+			sorts = []*purchases.SortField{{Field: field, Sort: pagination.GetSort()}}
+		case len(rank) > 0:
+			sorts = []*purchases.SortField{{Field: "rank", Sort: purchases.Pagination_DESC}}
+		default:
+			sorts = []*purchases.SortField{{Field: f.defaultField, Sort: pagination.GetSort()}}
+		}
+	}
+
+	if len(sorts) > maxSortFields {
+		return nil, status.Errorf(codes.InvalidArgument, "Please supply at most %d sort fields", maxSortFields)
+	}
+
+	var keys keyset
+	used := make(map[string]bool)
+	for _, sort := range sorts {
+		expr, ok := fields[sort.GetField()]
+		if !ok || used[sort.GetField()] {
+			return nil, status.Errorf(codes.InvalidArgument, "Please supply valid sort field %s", sort.GetField())
+		}
+
+		if _, ok := purchases.Pagination_Sort_name[int32(sort.GetSort())]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Please supply valid sort of %s", sort.GetField())
+		}
+
+		used[sort.GetField()] = true
+		keys = append(keys, sortKey{expr: expr, desc: sort.GetSort() == purchases.Pagination_DESC})
+	}
+
+	return append(keys, sortKey{expr: f.id, desc: keys[len(keys)-1].desc}), nil
+}
+
+// exportPagination return the pagination of an export: the search and sorts of the listing without page, cursor and count.
+// A listing without sort is exported ordered by code.
+func exportPagination(pagination *purchases.Pagination) *purchases.Pagination {
+	export := &purchases.Pagination{
+		Search:    pagination.GetSearch(),
+		OrderBy:   pagination.GetOrderBy(),
+		Sort:      pagination.GetSort(),
+		Sorts:     pagination.GetSorts(),
+		CountMode: purchases.Pagination_NONE,
+	}
+
+	if len(export.GetSorts()) == 0 && len(export.GetOrderBy()) == 0 {
+		export.Sorts = []*purchases.SortField{{Field: "code", Sort: export.GetSort()}}
+	}
+
+	return export
+}
+
+// searchQuery return the prefix tsquery of the words of search, ex: "acme pip" is "acme:* & pip:*".
+// Words keep only letters and digits, so the query is always valid. Empty means search has no word.
+func searchQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// EncodeCursor return the opaque cursor of the cursor column selected by list query
+func EncodeCursor(column string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(column))
+}
+
+// listCount count the rows of from filtered by where as the count mode of pagination.
+// The estimated count is the row estimate of the query planner, it does not scan the rows.
+func listCount(ctx context.Context, db *sql.DB, from string, where []string, paramQueries []interface{}, mode purchases.Pagination_CountMode) (uint32, bool, error) {
+	switch mode {
+	case purchases.Pagination_NONE:
+		return 0, false, nil
+
+	case purchases.Pagination_ESTIMATED:
+		var plan string
+		qPlan := `EXPLAIN (FORMAT JSON) SELECT 1 FROM ` + from + ` WHERE ` + strings.Join(where, " AND ")
+		if err := db.QueryRowContext(ctx, qPlan, paramQueries...).Scan(&plan); err != nil {
+			return 0, true, status.Errorf(codes.Internal, "Query estimate count: %v", err)
+		}
+
+		var plans []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			}
+		}
+		if err := json.Unmarshal([]byte(plan), &plans); err != nil || len(plans) == 0 {
+			return 0, true, status.Errorf(codes.Internal, "unmarshal estimate count: %v", err)
+		}
+
+		return uint32(plans[0].Plan.Rows), true, nil
+	}
+
+	var count int
+	qCount := `SELECT COUNT(*) FROM ` + from + ` WHERE ` + strings.Join(where, " AND ")
+	err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, status.Error(codes.Internal, err.Error())
+	}
+
+	return uint32(count), false, nil
+}
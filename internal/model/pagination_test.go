@@ -0,0 +1,158 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rowCursor return the cursor of a row as the cursor column of list query, the json array of signature and key values
+func rowCursor(keys keyset, values ...string) string {
+	column := fmt.Sprintf("[%q", keys.signature())
+	for _, value := range values {
+		column += ", " + value
+	}
+
+	return EncodeCursor(column + "]")
+}
+
+func TestKeysetCursor(t *testing.T) {
+	const id = "7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"
+
+	tests := []struct {
+		name       string
+		pagination *purchases.Pagination
+		values     []string
+		orderBy    string
+		after      string
+		params     []interface{}
+	}{
+		{
+			name:       "default",
+			pagination: &purchases.Pagination{},
+			values:     []string{`"2024-08-01T10:00:00+00:00"`, `"` + id + `"`},
+			orderBy:    "purchases.created_at ASC, purchases.id ASC",
+			after:      "((purchases.created_at > $2) OR (purchases.created_at = $2 AND purchases.id > $3))",
+			params:     []interface{}{"company", "2024-08-01T10:00:00+00:00", id},
+		},
+		{
+			name:       "legacy order by",
+			pagination: &purchases.Pagination{OrderBy: "purchases.code", Sort: purchases.Pagination_DESC},
+			values:     []string{`"PO-002"`, `"` + id + `"`},
+			orderBy:    "purchases.code DESC, purchases.id DESC",
+			after:      "((purchases.code < $2) OR (purchases.code = $2 AND purchases.id < $3))",
+			params:     []interface{}{"company", "PO-002", id},
+		},
+		{
+			name: "mixed asc and desc",
+			pagination: &purchases.Pagination{Sorts: []*purchases.SortField{
+				{Field: "supplier_name"},
+				{Field: "total_price", Sort: purchases.Pagination_DESC},
+			}},
+			values:  []string{`"Acme"`, `1250.5`, `"` + id + `"`},
+			orderBy: "suppliers.name ASC, purchases.total_price DESC, purchases.id DESC",
+			after: "((suppliers.name > $2) OR (suppliers.name = $2 AND purchases.total_price < $3) OR " +
+				"(suppliers.name = $2 AND purchases.total_price = $3 AND purchases.id < $4))",
+			params: []interface{}{"company", "Acme", "1250.5", id},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := purchaseSortFields.keyset(tt.pagination, "")
+			if err != nil {
+				t.Fatalf("keyset: %v", err)
+			}
+
+			if got := keys.orderBy(); got != tt.orderBy {
+				t.Errorf("orderBy = %q, want %q", got, tt.orderBy)
+			}
+
+			after, params, err := keys.after(rowCursor(keys, tt.values...), []interface{}{"company"})
+			if err != nil {
+				t.Fatalf("after: %v", err)
+			}
+
+			if after != tt.after {
+				t.Errorf("after = %q, want %q", after, tt.after)
+			}
+
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("params = %v, want %v", params, tt.params)
+			}
+		})
+	}
+}
+
+func TestKeysetCursorRejected(t *testing.T) {
+	keys, err := purchaseSortFields.keyset(&purchases.Pagination{Sorts: []*purchases.SortField{{Field: "code"}}}, "")
+	if err != nil {
+		t.Fatalf("keyset: %v", err)
+	}
+
+	otherKeys, err := purchaseSortFields.keyset(&purchases.Pagination{Sorts: []*purchases.SortField{{Field: "code", Sort: purchases.Pagination_DESC}}}, "")
+	if err != nil {
+		t.Fatalf("keyset: %v", err)
+	}
+
+	valid := rowCursor(keys, `"PO-001"`, `"7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"`)
+	raw, _ := base64.RawURLEncoding.DecodeString(valid)
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"signature of other ordering", rowCursor(otherKeys, `"PO-001"`, `"7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"`)},
+		{"tampered signature", EncodeCursor(`["00000000", "PO-001", "7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"]`)},
+		{"not base64", "%%%"},
+		{"padded base64", base64.URLEncoding.EncodeToString(raw) + "=="},
+		{"not json", EncodeCursor("PO-001")},
+		{"truncated json", EncodeCursor(string(raw[:len(raw)-1]))},
+		{"missing key value", rowCursor(keys, `"PO-001"`)},
+		{"extra key value", rowCursor(keys, `"PO-001"`, `"7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"`, `"x"`)},
+		{"null key value", rowCursor(keys, `null`, `"7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"`)},
+		{"object key value", rowCursor(keys, `{"code": "PO-001"}`, `"7d1c1c5e-3b1e-4d2a-9f47-1f0b8a2c9e10"`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paramQueries := []interface{}{"company"}
+			_, params, err := keys.after(tt.cursor, paramQueries)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("after = %v, want InvalidArgument", err)
+			}
+
+			if len(params) != len(paramQueries) {
+				t.Errorf("params = %v, want the params unchanged", params)
+			}
+		})
+	}
+}
+
+func TestKeysetInvalidSort(t *testing.T) {
+	tests := []struct {
+		name       string
+		pagination *purchases.Pagination
+	}{
+		{"unknown field", &purchases.Pagination{Sorts: []*purchases.SortField{{Field: "remark"}}}},
+		{"repeated field", &purchases.Pagination{Sorts: []*purchases.SortField{{Field: "code"}, {Field: "code", Sort: purchases.Pagination_DESC}}}},
+		{"rank without search", &purchases.Pagination{Sorts: []*purchases.SortField{{Field: "rank"}}}},
+		{"invalid sort", &purchases.Pagination{Sorts: []*purchases.SortField{{Field: "code", Sort: purchases.Pagination_Sort(9)}}}},
+		{"too many fields", &purchases.Pagination{Sorts: []*purchases.SortField{
+			{Field: "code"}, {Field: "purchase_date"}, {Field: "branch_name"}, {Field: "supplier_name"}, {Field: "total_price"}, {Field: "created_at"},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := purchaseSortFields.keyset(tt.pagination, ""); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("keyset = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultPriceVarianceThreshold is used when neither the request nor the purchase setting has a threshold
+const DefaultPriceVarianceThreshold = 10
+
+// DefaultPriceVarianceWindow is the number of previous purchases of the moving average
+const DefaultPriceVarianceWindow = 5
+
+// PriceReport read the unit price of purchase lines per supplier and product
+type PriceReport struct {
+	DateFrom   time.Time
+	DateTo     time.Time
+	ProductId  string
+	SupplierId string
+	// Scope limit the report to the branches of the user login, nil means all branches
+	Scope *BranchScope
+}
+
+// filter return the condition of supplier, product and branch scope, the parameters are appended to paramQueries
+func (u *PriceReport) filter(paramQueries *[]interface{}) string {
+	var where string
+	if len(u.SupplierId) > 0 {
+		*paramQueries = append(*paramQueries, u.SupplierId)
+		where += fmt.Sprintf(" AND purchases.supplier_id = $%d", len(*paramQueries))
+	}
+
+	if len(u.ProductId) > 0 {
+		*paramQueries = append(*paramQueries, u.ProductId)
+		where += fmt.Sprintf(" AND purchase_details.product_id = $%d", len(*paramQueries))
+	}
+
+	if u.Scope != nil {
+		*paramQueries = append(*paramQueries, pq.Array(u.Scope.BranchIds))
+		where += fmt.Sprintf(" AND purchases.branch_id = ANY($%d::uuid[])", len(*paramQueries))
+	}
+
+	return where
+}
+
+// History call send with the price history of each supplier and product, ordered by product and supplier.
+// The average price is weighted by quantity, the last price is the price of the latest purchase.
+func (u *PriceReport) History(ctx context.Context, db *sql.DB, send func(*purchases.PriceHistory) error) error {
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.DateFrom, u.DateTo}
+	query := `
+		SELECT purchases.supplier_id, suppliers.code, suppliers.name,
+			purchase_details.product_id, purchase_details.product_code, purchase_details.product_name,
+			purchases.id, purchases.code, purchases.purchase_date, purchases.branch_id, purchases.branch_name,
+			purchase_details.price, purchase_details.total_price, purchase_details.quantity
+		FROM purchases
+		JOIN purchase_details ON purchases.id = purchase_details.purchase_id
+		JOIN suppliers ON purchases.supplier_id = suppliers.id
+		WHERE purchases.company_id = $1 AND purchases.purchase_date BETWEEN $2 AND $3 ` + u.filter(&paramQueries) + `
+		ORDER BY purchase_details.product_id, purchases.supplier_id, purchases.purchase_date, purchases.created_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query price history: %v", err)
+	}
+	defer rows.Close()
+
+	var history *purchases.PriceHistory
+	var amount float64
+	flush := func() error {
+		if history == nil {
+			return nil
+		}
+		if history.GetQuantity() > 0 {
+			history.AveragePrice = amount / float64(history.GetQuantity())
+		}
+		return send(history)
+	}
+
+	for rows.Next() {
+		var supplierID, supplierCode, supplierName, productID, productCode, productName string
+		var point purchases.PricePoint
+		var purchaseDate time.Time
+		var totalPrice float64
+		err = rows.Scan(&supplierID, &supplierCode, &supplierName, &productID, &productCode, &productName,
+			&point.PurchaseId, &point.PurchaseCode, &purchaseDate, &point.BranchId, &point.BranchName,
+			&point.Price, &totalPrice, &point.Quantity)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		point.PurchaseDate = purchaseDate.String()
+		if point.GetQuantity() > 0 {
+			point.NetPrice = totalPrice / float64(point.GetQuantity())
+		}
+
+		if history == nil || history.GetSupplierId() != supplierID || history.GetProductId() != productID {
+			if err := flush(); err != nil {
+				return err
+			}
+
+			history = &purchases.PriceHistory{
+				SupplierId:   supplierID,
+				SupplierCode: supplierCode,
+				SupplierName: supplierName,
+				ProductId:    productID,
+				MinPrice:     point.GetPrice(),
+				MaxPrice:     point.GetPrice(),
+			}
+			amount = 0
+		}
+
+		// the snapshot of the latest purchase is the current code and name of the product
+		history.ProductCode = productCode
+		history.ProductName = productName
+		history.MinPrice = math.Min(history.GetMinPrice(), point.GetPrice())
+		history.MaxPrice = math.Max(history.GetMaxPrice(), point.GetPrice())
+		history.LastPrice = point.GetPrice()
+		history.LastPurchaseDate = point.GetPurchaseDate()
+		history.PurchaseCount++
+		history.Quantity += int64(point.GetQuantity())
+		amount += point.GetPrice() * float64(point.GetQuantity())
+		history.Points = append(history.Points, &point)
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return flush()
+}
+
+// Variance call send with the purchase lines dated in the period whose unit price deviate from the reference price
+// by more than threshold percent. The reference is the price of the previous purchase of the same supplier and product,
+// or the average price of its previous window purchases. Purchases before the period are used as reference too.
+func (u *PriceReport) Variance(ctx context.Context, db *sql.DB, basis purchases.PriceVarianceBasis, window int, threshold float64,
+	send func(*purchases.PriceVariance) error) error {
+	reference := "LAG(purchase_details.price) OVER w"
+	if basis == purchases.PriceVarianceBasis_MOVING_AVERAGE {
+		// window is an integer, the frame offset is written into the query
+		reference = fmt.Sprintf("AVG(purchase_details.price) OVER (w ROWS BETWEEN %d PRECEDING AND 1 PRECEDING)", window)
+	}
+
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.DateFrom, u.DateTo}
+	filter := u.filter(&paramQueries)
+	paramQueries = append(paramQueries, threshold)
+	query := `
+		WITH lines AS (
+			SELECT purchases.id, purchases.code, purchases.purchase_date, purchases.created_at, purchases.branch_id, purchases.branch_name,
+				purchases.supplier_id, purchase_details.product_id, purchase_details.product_code, purchase_details.product_name,
+				purchase_details.price, ` + reference + ` reference_price
+			FROM purchases
+			JOIN purchase_details ON purchases.id = purchase_details.purchase_id
+			WHERE purchases.company_id = $1 AND purchases.purchase_date <= $3 ` + filter + `
+			WINDOW w AS (PARTITION BY purchases.supplier_id, purchase_details.product_id ORDER BY purchases.purchase_date, purchases.created_at)
+		)
+		SELECT lines.id, lines.code, lines.purchase_date, lines.branch_id, lines.branch_name,
+			suppliers.id, suppliers.code, suppliers.name, lines.product_id, lines.product_code, lines.product_name,
+			lines.price, lines.reference_price
+		FROM lines
+		JOIN suppliers ON lines.supplier_id = suppliers.id
+		WHERE lines.purchase_date >= $2 AND lines.reference_price > 0
+			AND ABS(lines.price - lines.reference_price) / lines.reference_price * 100 > $` + fmt.Sprint(len(paramQueries)) + `
+		ORDER BY lines.purchase_date, lines.created_at, lines.product_code
+	`
+
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query price variance: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variance purchases.PriceVariance
+		var purchaseDate time.Time
+		err = rows.Scan(&variance.PurchaseId, &variance.PurchaseCode, &purchaseDate, &variance.BranchId, &variance.BranchName,
+			&variance.SupplierId, &variance.SupplierCode, &variance.SupplierName,
+			&variance.ProductId, &variance.ProductCode, &variance.ProductName,
+			&variance.Price, &variance.ReferencePrice)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		variance.PurchaseDate = purchaseDate.String()
+		variance.VariancePercentage = percentage(variance.GetPrice()-variance.GetReferencePrice(), variance.GetReferencePrice())
+		variance.ThresholdPercentage = threshold
+
+		if err := send(&variance); err != nil {
+			return err
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return nil
+}
@@ -2,8 +2,10 @@ package model
 
 import (
 	"context"
+	"database/sql"
 	"io"
 
+	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -56,3 +58,98 @@ func (u *Product) List(ctx context.Context, in *inventories.ListProductRequest)
 
 	return response, nil
 }
+
+// ListWithoutSnapshot list id of products in purchase or return details written before the product snapshot was kept
+func (u *Product) ListWithoutSnapshot(ctx context.Context, db *sql.DB) ([]string, error) {
+	var list []string
+	query := `
+		SELECT purchase_details.product_id FROM purchase_details
+		JOIN purchases ON purchase_details.purchase_id = purchases.id
+		WHERE purchases.company_id = $1 AND purchase_details.product_code = ''
+		UNION
+		SELECT purchase_return_details.product_id FROM purchase_return_details
+		JOIN purchase_returns ON purchase_return_details.purchase_return_id = purchase_returns.id
+		WHERE purchase_returns.company_id = $1 AND purchase_return_details.product_code = ''
+	`
+
+	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query product without snapshot: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID string
+		if err := rows.Scan(&productID); err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+		list = append(list, productID)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+// BackfillSnapshot write code, name and unit of the product into the details without snapshot, return number of rows written.
+// Each detail written is recorded in audit log.
+func (u *Product) BackfillSnapshot(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var total int64
+	tables := []struct {
+		entity string
+		query  string
+	}{
+		{AuditPurchaseDetail, `SELECT purchase_details.id FROM purchase_details
+			JOIN purchases ON purchase_details.purchase_id = purchases.id
+			WHERE purchase_details.product_id = $1 AND purchase_details.product_code = '' AND purchases.company_id = $2
+			FOR UPDATE OF purchase_details`},
+		{AuditPurchaseReturnDetail, `SELECT purchase_return_details.id FROM purchase_return_details
+			JOIN purchase_returns ON purchase_return_details.purchase_return_id = purchase_returns.id
+			WHERE purchase_return_details.product_id = $1 AND purchase_return_details.product_code = '' AND purchase_returns.company_id = $2
+			FOR UPDATE OF purchase_return_details`},
+	}
+
+	for _, table := range tables {
+		var ids []string
+		rows, err := tx.QueryContext(ctx, table.query, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string))
+		if err != nil {
+			return total, status.Errorf(codes.Internal, "Query %s without snapshot: %v", table.entity, err)
+		}
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return total, status.Errorf(codes.Internal, "scan data: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		if rows.Err() != nil {
+			return total, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+		}
+
+		for _, id := range ids {
+			before, err := auditSnapshot(ctx, tx, table.entity, id)
+			if err != nil {
+				return total, err
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE `+table.entity+` SET product_code = $1, product_name = $2, product_unit = $3 WHERE id = $4`,
+				u.Pb.GetCode(), u.Pb.GetName(), u.Pb.GetUnit(), id)
+			if err != nil {
+				return total, status.Errorf(codes.Internal, "Exec backfill product snapshot: %v", err)
+			}
+
+			if err := writeAudit(ctx, tx, table.entity, id, auditUpdate, before); err != nil {
+				return total, err
+			}
+			total++
+		}
+	}
+
+	return total, nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-pkg/util"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -23,12 +24,15 @@ type Purchase struct {
 func (u *Purchase) Get(ctx context.Context, db *sql.DB) error {
 	query := `
 		SELECT purchases.id, purchases.company_id, purchases.branch_id, purchases.branch_name, suppliers.id, suppliers.name, purchases.code, 
-		purchases.purchase_date, purchases.remark, purchases.price, purchases.additional_disc_amount, purchases.additional_disc_percentage, purchases.total_price,
-		purchases.created_at, purchases.created_by, purchases.updated_at, purchases.updated_by,
+		purchases.purchase_date, purchases.expected_date, purchases.remark, purchases.price, purchases.additional_disc_amount, purchases.additional_disc_percentage, purchases.total_price,
+		purchases.created_at, purchases.created_by, purchases.updated_at, purchases.updated_by, purchases.version, purchases.email_status,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', purchase_details.id,
 			'purchase_id', purchase_details.purchase_id,
 			'product_id', purchase_details.product_id,
+			'product_code', purchase_details.product_code,
+			'product_name', purchase_details.product_name,
+			'product_unit', purchase_details.product_unit,
 			'price', purchase_details.price,
 			'disc_amount', purchase_details.disc_amount,
 			'disc_percentage', purchase_details.disc_percentage,
@@ -48,13 +52,14 @@ func (u *Purchase) Get(ctx context.Context, db *sql.DB) error {
 	defer stmt.Close()
 
 	var datePurchase, createdAt, updatedAt time.Time
-	var companyID, details string
+	var expectedDate sql.NullTime
+	var companyID, emailStatus, details string
 	var pbSupplier purchases.Supplier
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
 		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &pbSupplier.Id, &pbSupplier.Name,
-		&u.Pb.Code, &datePurchase, &u.Pb.Remark,
+		&u.Pb.Code, &datePurchase, &expectedDate, &u.Pb.Remark,
 		&u.Pb.Price, &u.Pb.AdditionalDiscAmount, &u.Pb.AdditionalDiscPercentage, &u.Pb.TotalPrice,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Pb.Version, &emailStatus, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -66,11 +71,15 @@ func (u *Purchase) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company")
+		return status.Error(codes.PermissionDenied, "its not your company")
 	}
 
 	u.Pb.PurchaseDate = datePurchase.String()
+	if expectedDate.Valid {
+		u.Pb.ExpectedDate = expectedDate.Time.String()
+	}
 	u.Pb.Supplier = &pbSupplier
+	u.Pb.EmailStatus = purchases.EmailStatus(purchases.EmailStatus_value[strings.ToUpper(emailStatus)])
 	u.Pb.CreatedAt = createdAt.String()
 	u.Pb.UpdatedAt = updatedAt.String()
 
@@ -78,6 +87,9 @@ func (u *Purchase) Get(ctx context.Context, db *sql.DB) error {
 		ID             string `json:"id"`
 		PurchaseID     string
 		ProductID      string `json:"product_id"`
+		ProductCode    string `json:"product_code"`
+		ProductName    string `json:"product_name"`
+		ProductUnit    string `json:"product_unit"`
 		Price          float64
 		DiscAmount     float64 `json:"disc_amount"`
 		DiscPercentage float32 `json:"disc_percentage"`
@@ -93,6 +105,9 @@ func (u *Purchase) Get(ctx context.Context, db *sql.DB) error {
 		u.Pb.Details = append(u.Pb.Details, &purchases.PurchaseDetail{
 			Id:             detail.ID,
 			ProductId:      detail.ProductID,
+			ProductCode:    detail.ProductCode,
+			ProductName:    detail.ProductName,
+			ProductUnit:    detail.ProductUnit,
 			PurchaseId:     detail.PurchaseID,
 			Price:          detail.Price,
 			Quantity:       int32(detail.Quantity),
@@ -150,14 +165,19 @@ func (u *Purchase) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "convert Date: %v", err)
 	}
 
+	expectedDate, err := u.expectedDate()
+	if err != nil {
+		return err
+	}
+
 	u.Pb.Code, err = util.GetCode(ctx, tx, "purchases", "PC")
 	if err != nil {
 		return err
 	}
 
 	query := `
-		INSERT INTO purchases (id, company_id, branch_id, branch_name, supplier_id, code, purchase_date, remark, price, additional_disc_amount, additional_disc_percentage, total_price, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		INSERT INTO purchases (id, company_id, branch_id, branch_name, supplier_id, code, purchase_date, expected_date, remark, price, additional_disc_amount, additional_disc_percentage, total_price, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -173,6 +193,7 @@ func (u *Purchase) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetSupplier().GetId(),
 		u.Pb.GetCode(),
 		datePurchase,
+		expectedDate,
 		u.Pb.GetRemark(),
 		u.Pb.GetPrice(),
 		u.Pb.GetAdditionalDiscAmount(),
@@ -189,12 +210,21 @@ func (u *Purchase) Create(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.Pb.Version = 1
+
+	err = writeAudit(ctx, tx, AuditPurchase, u.Pb.GetId(), auditCreate, nil)
+	if err != nil {
+		return err
+	}
 
 	for _, detail := range u.Pb.GetDetails() {
 		purchaseDetailModel := PurchaseDetail{}
 		purchaseDetailModel.Pb = purchases.PurchaseDetail{
 			PurchaseId:     u.Pb.GetId(),
 			ProductId:      detail.GetProductId(),
+			ProductCode:    detail.GetProductCode(),
+			ProductName:    detail.GetProductName(),
+			ProductUnit:    detail.GetProductUnit(),
 			Price:          detail.GetPrice(),
 			DiscAmount:     detail.GetDiscAmount(),
 			DiscPercentage: detail.GetDiscPercentage(),
@@ -208,6 +238,7 @@ func (u *Purchase) Create(ctx context.Context, tx *sql.Tx) error {
 			Supplier:                 u.Pb.GetSupplier(),
 			Code:                     u.Pb.Code,
 			PurchaseDate:             u.Pb.PurchaseDate,
+			ExpectedDate:             u.Pb.ExpectedDate,
 			Remark:                   u.Pb.Remark,
 			Price:                    u.Pb.Price,
 			AdditionalDiscAmount:     u.Pb.AdditionalDiscAmount,
@@ -235,18 +266,30 @@ func (u *Purchase) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "convert purchase date: %v", err)
 	}
 
+	expectedDate, err := u.expectedDate()
+	if err != nil {
+		return err
+	}
+
+	before, err := auditSnapshot(ctx, tx, AuditPurchase, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE purchases SET
 		supplier_id = $1,
 		purchase_date = $2,
-		remark = $3, 
-		price = $4,
-		additional_disc_amount = $5,
-		additional_disc_percentage = $6,
-		total_price = $7,
-		updated_at = $8, 
-		updated_by= $9
-		WHERE id = $10
+		expected_date = $3,
+		remark = $4, 
+		price = $5,
+		additional_disc_amount = $6,
+		additional_disc_percentage = $7,
+		total_price = $8,
+		updated_at = $9, 
+		updated_by= $10,
+		version = version + 1
+		WHERE id = $11 AND version = $12
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -254,9 +297,10 @@ func (u *Purchase) Update(ctx context.Context, tx *sql.Tx) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		u.Pb.GetSupplier().GetId(),
 		datePurchase,
+		expectedDate,
 		u.Pb.GetRemark(),
 		u.Pb.GetPrice(),
 		u.Pb.GetAdditionalDiscAmount(),
@@ -265,26 +309,92 @@ func (u *Purchase) Update(ctx context.Context, tx *sql.Tx) error {
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
+		u.Pb.GetVersion(),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update purchase: %v", err)
 	}
 
+	if err := checkVersion(result); err != nil {
+		return err
+	}
+
 	u.Pb.UpdatedAt = now.String()
+	u.Pb.Version++
+
+	return writeAudit(ctx, tx, AuditPurchase, u.Pb.GetId(), auditUpdate, before)
+}
+
+// Lock the purchase row until the transaction end and check it has not been changed since it was read
+func (u *Purchase) Lock(ctx context.Context, tx *sql.Tx) error {
+	var version int32
+	err := tx.QueryRowContext(ctx, `SELECT version FROM purchases WHERE id = $1 AND company_id = $2 FOR UPDATE`,
+		u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&version)
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw lock purchase: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw lock purchase: %v", err)
+	}
+
+	if version != u.Pb.GetVersion() {
+		return ErrVersionConflict
+	}
 
 	return nil
 }
 
-func (u *Purchase) ListQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseRequest) (string, []interface{}, *purchases.PurchasePaginationResponse, error) {
+func (u *Purchase) expectedDate() (sql.NullTime, error) {
+	var expectedDate sql.NullTime
+	if len(u.Pb.GetExpectedDate()) == 0 {
+		return expectedDate, nil
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetExpectedDate())
+	if err != nil {
+		// value read back by Get is formatted with time.Time.String()
+		t, err = time.Parse("2006-01-02 15:04:05 -0700 MST", u.Pb.GetExpectedDate())
+		if err != nil {
+			return expectedDate, status.Errorf(codes.Internal, "convert expected date: %v", err)
+		}
+	}
+
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// purchaseSortFields is the sort fields of purchase listing
+var purchaseSortFields = sortFields{
+	fields: map[string]string{
+		"code":          "purchases.code",
+		"purchase_date": "purchases.purchase_date",
+		"branch_name":   "purchases.branch_name",
+		"supplier_code": "suppliers.code",
+		"supplier_name": "suppliers.name",
+		"total_price":   "purchases.total_price",
+		"created_at":    "purchases.created_at",
+		"updated_at":    "purchases.updated_at",
+	},
+	legacy:       "purchases",
+	defaultField: "created_at",
+	id:           "purchases.id",
+}
+
+// ListQuery build list query of purchases. When scope is not nil, only purchases of the scope branches are listed.
+func (u *Purchase) ListQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseRequest, scope *BranchScope) (string, []interface{}, *purchases.PurchasePaginationResponse, error) {
+	return u.listQuery(ctx, db, in, in.GetPagination(), scope)
+}
+
+// listQuery build the list query of the filter of in, paged and ordered by pagination
+func (u *Purchase) listQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseRequest, pagination *purchases.Pagination, scope *BranchScope) (string, []interface{}, *purchases.PurchasePaginationResponse, error) {
 	var paginationResponse purchases.PurchasePaginationResponse
 	query := `
 		SELECT purchases.id, purchases.company_id, purchases.branch_id, purchases.branch_name, 
 			purchases.supplier_id, suppliers.name supplier_name, purchases.code, purchases.purchase_date, 
 			purchases.remark, purchases.price, purchases.additional_disc_amount, 
 			purchases.additional_disc_percentage, purchases.total_price, 
-			purchases.created_at, purchases.created_by, purchases.updated_at, purchases.updated_by 
-		FROM purchases JOIN suppliers on purchases.supplier_id = suppliers.id
-	`
+			purchases.created_at, purchases.created_by, purchases.updated_at, purchases.updated_by`
+	from := `purchases JOIN suppliers ON purchases.supplier_id = suppliers.id`
 
 	where := []string{"purchases.company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
@@ -294,53 +404,145 @@ func (u *Purchase) ListQuery(ctx context.Context, db *sql.DB, in *purchases.List
 		where = append(where, fmt.Sprintf(`purchases.branch_id = $%d`, len(paramQueries)))
 	}
 
+	if scope != nil {
+		paramQueries = append(paramQueries, pq.Array(scope.BranchIds))
+		where = append(where, fmt.Sprintf(`purchases.branch_id = ANY($%d::uuid[])`, len(paramQueries)))
+	}
+
 	if len(in.GetSupplierId()) > 0 {
 		paramQueries = append(paramQueries, in.GetSupplierId())
 		where = append(where, fmt.Sprintf(`purchases.supplier_id = $%d`, len(paramQueries)))
 	}
 
-	if len(in.GetPagination().GetSearch()) > 0 {
-		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
-		where = append(where, fmt.Sprintf(`(purchases.code ILIKE $%d OR purchases.remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	filter := documentFilter{
+		table:         "purchases",
+		dateColumn:    "purchase_date",
+		detailTable:   "purchase_details",
+		detailKey:     "purchase_id",
+		DateFrom:      in.GetDateFrom(),
+		DateTo:        in.GetDateTo(),
+		CreatedFrom:   in.GetCreatedFrom(),
+		CreatedTo:     in.GetCreatedTo(),
+		TotalPriceMin: in.GetTotalPriceMin(),
+		TotalPriceMax: in.GetTotalPriceMax(),
+		ProductId:     in.GetProductId(),
+		CreatedBy:     in.GetCreatedBy(),
+	}
+	where, paramQueries, err := filter.apply(where, paramQueries)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	{
-		qCount := `SELECT COUNT(*) FROM purchases JOIN suppliers ON purchases.supplier_id = suppliers.id`
-		if len(where) > 0 {
-			qCount += " WHERE " + strings.Join(where, " AND ")
+	if len(in.GetEmailStatuses()) > 0 {
+		var emailStatuses []string
+		for _, emailStatus := range in.GetEmailStatuses() {
+			emailStatuses = append(emailStatuses, strings.ToLower(emailStatus.String()))
 		}
-		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
-		if err != nil && err != sql.ErrNoRows {
-			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		paramQueries = append(paramQueries, pq.Array(emailStatuses))
+		where = append(where, fmt.Sprintf(`purchases.email_status = ANY($%d)`, len(paramQueries)))
+	}
+
+	// the search match the words of code, remark, supplier and products of the details, the code also match by trigram
+	var rank string
+	if len(pagination.GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+pagination.GetSearch()+"%")
+		condition := fmt.Sprintf(`purchases.code::text ILIKE $%d`, len(paramQueries))
+		if tsquery := searchQuery(pagination.GetSearch()); len(tsquery) > 0 {
+			paramQueries = append(paramQueries, tsquery)
+			condition = fmt.Sprintf(`(purchases.search_vector @@ to_tsquery('simple', $%d) OR %s)`, len(paramQueries), condition)
+			rank = fmt.Sprintf(`ts_rank(purchases.search_vector, to_tsquery('simple', $%d))`, len(paramQueries))
 		}
+		where = append(where, condition)
+	}
 
-		paginationResponse.Count = uint32(count)
+	keys, err := purchaseSortFields.keyset(pagination, rank)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
+	count, estimated, err := listCount(ctx, db, from, where, paramQueries, pagination.GetCountMode())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
+	paginationResponse.Count = count
+	paginationResponse.Estimated = estimated
 
-	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "purchases.code") {
-		if in.GetPagination() == nil {
-			in.Pagination = &purchases.Pagination{OrderBy: "created_at"}
-		} else {
-			in.GetPagination().OrderBy = "created_at"
+	if len(pagination.GetCursor()) > 0 {
+		var after string
+		after, paramQueries, err = keys.after(pagination.GetCursor(), paramQueries)
+		if err != nil {
+			return query, paramQueries, &paginationResponse, err
 		}
+		where = append(where, after)
 	}
 
-	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+	query += `, ` + keys.column() + ` cursor FROM ` + from + ` WHERE ` + strings.Join(where, " AND ")
+	query += ` ORDER BY ` + keys.orderBy()
 
-	if in.GetPagination().GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	// the offset is not used with cursor, the cursor already skip the previous rows
+	if pagination.GetLimit() > 0 {
+		paramQueries = append(paramQueries, pagination.GetLimit())
+		query += fmt.Sprintf(` LIMIT $%d`, len(paramQueries))
+		if len(pagination.GetCursor()) == 0 {
+			paramQueries = append(paramQueries, pagination.GetOffset())
+			query += fmt.Sprintf(` OFFSET $%d`, len(paramQueries))
+		}
 	}
 
 	return query, paramQueries, &paginationResponse, nil
 }
 
+// ExportQuery return the list query of the filter in the sorts of its pagination, ordered by code when there is no sort,
+// without limit. The request is not modified. With lines, every row of the list is joined with its details
+// ordered by product code, the position column keep the order of the list.
+func (u *Purchase) ExportQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseRequest, scope *BranchScope, lines bool) (string, []interface{}, error) {
+	query, paramQueries, _, err := u.listQuery(ctx, db, in, exportPagination(in.GetPagination()), scope)
+	if err != nil {
+		return query, paramQueries, err
+	}
+
+	if !lines {
+		return query, paramQueries, nil
+	}
+
+	query = `
+		SELECT list.*, purchase_details.product_code, purchase_details.product_name, purchase_details.product_unit,
+			purchase_details.quantity, purchase_details.price, purchase_details.disc_amount, purchase_details.disc_percentage,
+			purchase_details.total_price
+		FROM (SELECT numbered.*, row_number() OVER () position FROM (` + query + `) numbered (id, company_id, branch_id, branch_name, supplier_id, supplier_name, code, purchase_date,
+			remark, price, additional_disc_amount, additional_disc_percentage, total_price,
+			created_at, created_by, updated_at, updated_by, cursor)) list
+		JOIN purchase_details ON list.id = purchase_details.purchase_id
+		ORDER BY list.position, purchase_details.product_code
+	`
+
+	return query, paramQueries, nil
+}
+
 func (u *Purchase) OutstandingDetail(ctx context.Context, db *sql.DB, purchaseReturnId *string) ([]*purchases.PurchaseDetail, error) {
+	return u.outstandingDetail(ctx, db, purchaseReturnId)
+}
+
+// LockOutstandingDetail lock the purchase until the transaction end before reading the outstanding details,
+// so concurrent returns of the same purchase are checked and written one after another.
+func (u *Purchase) LockOutstandingDetail(ctx context.Context, tx *sql.Tx, purchaseReturnId *string) ([]*purchases.PurchaseDetail, error) {
+	var id string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM purchases WHERE id = $1 AND company_id = $2 FOR UPDATE`,
+		u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, status.Errorf(codes.NotFound, "Query Raw lock purchase: %v", err)
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query Raw lock purchase: %v", err)
+	}
+
+	return u.outstandingDetail(ctx, tx, purchaseReturnId)
+}
+
+func (u *Purchase) outstandingDetail(ctx context.Context, db interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}, purchaseReturnId *string) ([]*purchases.PurchaseDetail, error) {
 	var list []*purchases.PurchaseDetail
 
 	queryReturn := `
@@ -356,7 +558,8 @@ func (u *Purchase) OutstandingDetail(ctx context.Context, db *sql.DB, purchaseRe
 	queryReturn += ` GROUP BY purchase_return_details.product_id`
 
 	query := `
-		SELECT purchase_details.product_id, (purchase_details.quantity - coalesce(purchase_returns.return_quantity, 0)) quantity,
+		SELECT purchase_details.product_id, purchase_details.product_code, purchase_details.product_name, purchase_details.product_unit,
+			(purchase_details.quantity - coalesce(purchase_returns.return_quantity, 0)) quantity,
 			purchase_details.price, purchase_details.disc_percentage
 		FROM purchase_details 
 		JOIN purchases ON purchase_details.purchase_id = purchases.id
@@ -387,6 +590,9 @@ func (u *Purchase) OutstandingDetail(ctx context.Context, db *sql.DB, purchaseRe
 		var pbPurchaseDetail purchases.PurchaseDetail
 		err = rows.Scan(
 			&pbPurchaseDetail.ProductId,
+			&pbPurchaseDetail.ProductCode,
+			&pbPurchaseDetail.ProductName,
+			&pbPurchaseDetail.ProductUnit,
 			&pbPurchaseDetail.Quantity,
 			&pbPurchaseDetail.Price,
 			&pbPurchaseDetail.DiscPercentage,
@@ -411,7 +617,7 @@ func (u *Purchase) GetReturnAdditionalDisc(ctx context.Context, db *sql.DB) (flo
 		SELECT SUM(purchase_returns.additional_disc_amount) return_additional_disc
 		FROM purchases
 		JOIN purchase_returns ON purchases.id = purchase_returns.purchase_id
-		WHERE purchases.id = $1
+		WHERE purchases.id = $1 AND purchases.company_id = $2
 		GROUP BY purchases.id
 	`
 	stmt, err := db.PrepareContext(ctx, query)
@@ -420,7 +626,7 @@ func (u *Purchase) GetReturnAdditionalDisc(ctx context.Context, db *sql.DB) (flo
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(&returnAdditionalDisc)
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&returnAdditionalDisc)
 
 	if err == sql.ErrNoRows {
 		return returnAdditionalDisc, nil
@@ -19,6 +19,7 @@ type PurchaseDetail struct {
 func (u *PurchaseDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		SELECT purchase_details.id, purchases.company_id, purchase_details.purchase_id, purchase_details.product_id, 
+			purchase_details.product_code, purchase_details.product_name, purchase_details.product_unit,
 			purchase_details.price, purchase_details.disc_amount, purchase_details.disc_percentage, purchase_details.quantity, purchase_details.total_price
 		FROM purchase_details 
 		JOIN purchases ON purchase_details.purchase_id = purchases.id
@@ -33,7 +34,7 @@ func (u *PurchaseDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	var companyID string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetPurchaseId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.PurchaseId, &u.Pb.ProductId, &u.Pb.Price, &u.Pb.DiscAmount, &u.Pb.DiscPercentage, &u.Pb.Quantity, &u.Pb.TotalPrice,
+		&u.Pb.Id, &companyID, &u.Pb.PurchaseId, &u.Pb.ProductId, &u.Pb.ProductCode, &u.Pb.ProductName, &u.Pb.ProductUnit, &u.Pb.Price, &u.Pb.DiscAmount, &u.Pb.DiscPercentage, &u.Pb.Quantity, &u.Pb.TotalPrice,
 	)
 
 	if err == sql.ErrNoRows {
@@ -45,7 +46,7 @@ func (u *PurchaseDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	}
 
 	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company")
+		return status.Error(codes.PermissionDenied, "its not your company")
 	}
 
 	return nil
@@ -54,8 +55,9 @@ func (u *PurchaseDetail) Get(ctx context.Context, tx *sql.Tx) error {
 func (u *PurchaseDetail) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	query := `
-		INSERT INTO purchase_details (id, purchase_id, product_id, price, disc_amount, disc_percentage, quantity, total_price) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO purchase_details (id, purchase_id, product_id, product_code, product_name, product_unit, 
+			price, disc_amount, disc_percentage, quantity, total_price) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -67,6 +69,9 @@ func (u *PurchaseDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetId(),
 		u.Pb.GetPurchaseId(),
 		u.Pb.GetProductId(),
+		u.Pb.GetProductCode(),
+		u.Pb.GetProductName(),
+		u.Pb.GetProductUnit(),
 		u.Pb.GetPrice(),
 		u.Pb.GetDiscAmount(),
 		u.Pb.GetDiscPercentage(),
@@ -77,10 +82,15 @@ func (u *PurchaseDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert purchase detail: %v", err)
 	}
 
-	return nil
+	return writeAudit(ctx, tx, AuditPurchaseDetail, u.Pb.GetId(), auditCreate, nil)
 }
 
 func (u *PurchaseDetail) Update(ctx context.Context, tx *sql.Tx) error {
+	before, err := auditSnapshot(ctx, tx, AuditPurchaseDetail, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE purchase_details
 		SET price = $1,
@@ -108,10 +118,15 @@ func (u *PurchaseDetail) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert purchase detail: %v", err)
 	}
 
-	return nil
+	return writeAudit(ctx, tx, AuditPurchaseDetail, u.Pb.GetId(), auditUpdate, before)
 }
 
 func (u *PurchaseDetail) Delete(ctx context.Context, tx *sql.Tx) error {
+	before, err := auditSnapshot(ctx, tx, AuditPurchaseDetail, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, `DELETE FROM purchase_details WHERE id = $1 AND purchase_id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete purchase detail: %v", err)
@@ -123,7 +138,7 @@ func (u *PurchaseDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete purchase detail: %v", err)
 	}
 
-	return nil
+	return writeAudit(ctx, tx, AuditPurchaseDetail, u.Pb.GetId(), auditDelete, before)
 }
 
 func (u *PurchaseDetail) SetPbFromPointer(data *purchases.PurchaseDetail) {
@@ -0,0 +1,204 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PurchaseEmail is an attempt to send purchase order to the supplier by email
+type PurchaseEmail struct {
+	Pb purchases.PurchaseEmail
+}
+
+const purchaseEmailColumns = `purchase_emails.id, purchases.company_id, purchase_emails.purchase_id,
+	purchase_emails.recipients, purchase_emails.cc, purchase_emails.subject, purchase_emails.status, purchase_emails.error,
+	purchase_emails.resend_of, purchase_emails.file_key, purchase_emails.created_at, purchase_emails.created_by, purchase_emails.sent_at`
+
+func (u *PurchaseEmail) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT ` + purchaseEmailColumns + `
+		FROM purchase_emails
+		JOIN purchases ON purchase_emails.purchase_id = purchases.id
+		WHERE purchase_emails.id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get purchase email: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	err = u.scan(stmt.QueryRowContext(ctx, u.Pb.GetId()), &companyID)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get purchase email: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get purchase email: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.PermissionDenied, "its not your company data")
+	}
+
+	return nil
+}
+
+// List the send attempts of the purchase, the latest first
+func (u *PurchaseEmail) List(ctx context.Context, db *sql.DB, purchaseID string) ([]*purchases.PurchaseEmail, error) {
+	var list []*purchases.PurchaseEmail
+	query := `
+		SELECT ` + purchaseEmailColumns + `
+		FROM purchase_emails
+		JOIN purchases ON purchase_emails.purchase_id = purchases.id
+		WHERE purchase_emails.purchase_id = $1 AND purchases.company_id = $2
+		ORDER BY purchase_emails.created_at DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, purchaseID, ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list purchase email: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email PurchaseEmail
+		var companyID string
+		err = email.scan(rows, &companyID)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		list = append(list, &email.Pb)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+// Create record the attempt as pending before the message is sent
+func (u *PurchaseEmail) Create(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.Id = uuid.New().String()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.Status = purchases.EmailStatus_PENDING
+
+	query := `
+		INSERT INTO purchase_emails (id, purchase_id, recipients, cc, subject, status, error, resend_of, file_key, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, '', $7, $8, $9, $10)
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert purchase email: %v", err)
+	}
+	defer stmt.Close()
+
+	var resendOf sql.NullString
+	if len(u.Pb.GetResendOf()) > 0 {
+		resendOf = sql.NullString{String: u.Pb.GetResendOf(), Valid: true}
+	}
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetPurchaseId(),
+		pq.Array(u.Pb.GetTo()),
+		pq.Array(u.Pb.GetCc()),
+		u.Pb.GetSubject(),
+		strings.ToLower(u.Pb.GetStatus().String()),
+		resendOf,
+		u.Pb.GetFileKey(),
+		now,
+		u.Pb.GetCreatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert purchase email: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+
+	return nil
+}
+
+// Finish record the result of sending, sendErr nil means the message is accepted by the transport.
+// The email status of the purchase follow its last attempt.
+func (u *PurchaseEmail) Finish(ctx context.Context, tx *sql.Tx, sendErr error) error {
+	now := time.Now().UTC()
+	var sentAt sql.NullTime
+	u.Pb.Status = purchases.EmailStatus_SENT
+	u.Pb.Error = ""
+	if sendErr != nil {
+		u.Pb.Status = purchases.EmailStatus_FAILED
+		u.Pb.Error = sendErr.Error()
+	} else {
+		sentAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE purchase_emails SET status = $1, error = $2, sent_at = $3 WHERE id = $4`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare update purchase email: %v", err)
+	}
+	defer stmt.Close()
+
+	emailStatus := strings.ToLower(u.Pb.GetStatus().String())
+	_, err = stmt.ExecContext(ctx, emailStatus, u.Pb.GetError(), sentAt, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update purchase email: %v", err)
+	}
+
+	before, err := auditSnapshot(ctx, tx, AuditPurchase, u.Pb.GetPurchaseId())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE purchases SET email_status = $1 WHERE id = $2`, emailStatus, u.Pb.GetPurchaseId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update purchase email status: %v", err)
+	}
+
+	if err := writeAudit(ctx, tx, AuditPurchase, u.Pb.GetPurchaseId(), auditUpdate, before); err != nil {
+		return err
+	}
+
+	if sentAt.Valid {
+		u.Pb.SentAt = now.String()
+	}
+
+	return nil
+}
+
+func (u *PurchaseEmail) scan(row interface{ Scan(...interface{}) error }, companyID *string) error {
+	var emailStatus string
+	var resendOf sql.NullString
+	var createdAt time.Time
+	var sentAt sql.NullTime
+	err := row.Scan(
+		&u.Pb.Id, companyID, &u.Pb.PurchaseId, pq.Array(&u.Pb.To), pq.Array(&u.Pb.Cc), &u.Pb.Subject, &emailStatus, &u.Pb.Error,
+		&resendOf, &u.Pb.FileKey, &createdAt, &u.Pb.CreatedBy, &sentAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Status = purchases.EmailStatus(purchases.EmailStatus_value[strings.ToUpper(emailStatus)])
+	u.Pb.ResendOf = resendOf.String
+	u.Pb.CreatedAt = createdAt.String()
+	if sentAt.Valid {
+		u.Pb.SentAt = sentAt.Time.String()
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package model_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/mail"
+	"github.com/jacky-htg/purchase-service/internal/service"
+	"github.com/jacky-htg/purchase-service/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failTransport reject every message, as an unreachable SMTP server does
+type failTransport struct{}
+
+func (t *failTransport) Send(ctx context.Context, msg *mail.Message) error {
+	return errors.New("connection refused")
+}
+
+// TestPurchaseEmailSend send a purchase to the contact of its supplier through the memory transport,
+// then fail to send it again and check both attempts are recorded with the email status of the purchase.
+func TestPurchaseEmailSend(t *testing.T) {
+	db := testDB(t)
+
+	companyID, userID, branchID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	supplierID, purchaseID := uuid.New().String(), uuid.New().String()
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), companyID)
+	ctx = context.WithValue(ctx, app.Ctx("userID"), userID)
+
+	setup := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO suppliers (id, company_id, code, name, address, phone, created_by, updated_by)
+			VALUES ($1, $2, 'SUP-TEST', $3, '', '', $4, $4)`, []interface{}{supplierID, companyID, "test " + supplierID[:8], userID}},
+		{`INSERT INTO supplier_contacts (id, supplier_id, name, role, email, phone, created_by, updated_by)
+			VALUES ($1, $2, 'Test', 'sales', 'sales@supplier.com', '', $3, $3)`, []interface{}{uuid.New().String(), supplierID, userID}},
+		{`INSERT INTO purchases (id, company_id, branch_id, branch_name, supplier_id, code, purchase_date, remark, price, total_price, created_by, updated_by)
+			VALUES ($1, $2, $3, 'Test', $4, 'PO-TEST', '2024-08-01', '', 1000, 1000, $5, $5)`, []interface{}{purchaseID, companyID, branchID, supplierID, userID}},
+		{`INSERT INTO purchase_details (id, purchase_id, product_id, product_code, product_name, product_unit, price, quantity, total_price)
+			VALUES ($1, $2, $3, 'P-001', 'Test Product', 'pcs', 100, 10, 1000)`, []interface{}{uuid.New().String(), purchaseID, uuid.New().String()}},
+	}
+	for _, s := range setup {
+		if _, err := db.ExecContext(ctx, s.query, s.args...); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, s := range []struct {
+			query string
+			id    string
+		}{
+			{`DELETE FROM purchase_emails WHERE purchase_id = $1`, purchaseID},
+			{`DELETE FROM purchases WHERE id = $1`, purchaseID},
+			{`DELETE FROM suppliers WHERE id = $1`, supplierID},
+		} {
+			if _, err := db.ExecContext(ctx, s.query, s.id); err != nil {
+				t.Errorf("cleanup: %v", err)
+			}
+		}
+	})
+
+	blob, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("create storage: %v", err)
+	}
+
+	transport := &mail.Memory{}
+	purchaseServer := &service.Purchase{
+		Db:           db,
+		UserClient:   &fakeUserClient{user: &users.User{Id: userID, BranchId: branchID}},
+		BranchClient: &fakeBranchClient{branch: &users.Branch{Id: branchID, Name: "Test"}},
+		Storage:      blob,
+		Mailer:       &mail.Mailer{Transport: transport, From: "purchasing@example.com"},
+	}
+
+	email, err := purchaseServer.PurchaseEmailSend(ctx, &purchases.PurchaseEmailRequest{PurchaseId: purchaseID})
+	if err != nil {
+		t.Fatalf("PurchaseEmailSend: %v", err)
+	}
+
+	if email.GetStatus() != purchases.EmailStatus_SENT {
+		t.Errorf("email status = %v, want SENT", email.GetStatus())
+	}
+
+	sent := transport.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("got %d sent messages, want 1", len(sent))
+	}
+
+	msg := sent[0]
+	if len(msg.To) != 1 || msg.To[0] != "sales@supplier.com" {
+		t.Errorf("recipients = %v, want the contact of the supplier", msg.To)
+	}
+
+	if msg.From != "purchasing@example.com" {
+		t.Errorf("sender = %q, want the sender of mailer", msg.From)
+	}
+
+	if msg.Subject != "Purchase Order PO-TEST" {
+		t.Errorf("subject = %q, want the default subject", msg.Subject)
+	}
+
+	if len(msg.Attachments) != 1 || msg.Attachments[0].ContentType != "application/pdf" || len(msg.Attachments[0].Data) == 0 {
+		t.Errorf("attachments = %d, want the pdf of the purchase", len(msg.Attachments))
+	}
+
+	if len(email.GetFileKey()) == 0 {
+		t.Error("sent document is not archived")
+	}
+
+	if got := emailStatus(ctx, t, db, purchaseID); got != "sent" {
+		t.Errorf("purchase email status = %q, want sent", got)
+	}
+
+	purchaseServer.Mailer = &mail.Mailer{Transport: &failTransport{}, From: "purchasing@example.com"}
+	_, err = purchaseServer.PurchaseEmailResend(ctx, &purchases.Id{Id: email.GetId()})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("PurchaseEmailResend with failing transport = %v, want Unavailable", err)
+	}
+
+	if got := emailStatus(ctx, t, db, purchaseID); got != "failed" {
+		t.Errorf("purchase email status = %q, want failed", got)
+	}
+
+	var attempts, audits int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM purchase_emails WHERE purchase_id = $1`, purchaseID).Scan(&attempts)
+	if err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("recorded %d attempts, want 2", attempts)
+	}
+
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_logs WHERE company_id = $1 AND entity = 'purchases' AND entity_id = $2`,
+		companyID, purchaseID).Scan(&audits)
+	if err != nil {
+		t.Fatalf("count audit logs: %v", err)
+	}
+
+	if audits != 2 {
+		t.Errorf("recorded %d audit logs of the purchase, want one per attempt", audits)
+	}
+}
+
+func emailStatus(ctx context.Context, t *testing.T, db *sql.DB, purchaseID string) string {
+	t.Helper()
+
+	var emailStatus string
+	if err := db.QueryRowContext(ctx, `SELECT email_status FROM purchases WHERE id = $1`, purchaseID).Scan(&emailStatus); err != nil {
+		t.Fatalf("query email status: %v", err)
+	}
+
+	return emailStatus
+}
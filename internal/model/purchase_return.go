@@ -12,6 +12,7 @@ import (
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-pkg/util"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -43,11 +44,14 @@ func (u *PurchaseReturn) Get(ctx context.Context, db *sql.DB) error {
 			purchase_returns.branch_name, purchase_returns.purchase_id, purchases.code, purchase_returns.code, 
 			purchase_returns.return_date, purchase_returns.remark, 
 			purchase_returns.price, purchase_returns.additional_disc_amount, purchase_returns.additional_disc_percentage, purchase_returns.total_price,
-			purchase_returns.created_at, purchase_returns.created_by, purchase_returns.updated_at, purchase_returns.updated_by,
+			purchase_returns.created_at, purchase_returns.created_by, purchase_returns.updated_at, purchase_returns.updated_by, purchase_returns.version,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', purchase_return_details.id,
 			'purchase_return_id', purchase_return_details.purchase_return_id,
 			'product_id', purchase_return_details.product_id,
+			'product_code', purchase_return_details.product_code,
+			'product_name', purchase_return_details.product_name,
+			'product_unit', purchase_return_details.product_unit,
 			'quantity', purchase_return_details.quantity,
 			'price', purchase_return_details.price,
 			'disc_amount', purchase_return_details.disc_amount,
@@ -74,7 +78,7 @@ func (u *PurchaseReturn) Get(ctx context.Context, db *sql.DB) error {
 		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName,
 		&purchase.Id, &purchase.Code, &u.Pb.Code, &dateReturn, &u.Pb.Remark,
 		&u.Pb.Price, &u.Pb.AdditionalDiscAmount, &u.Pb.AdditionalDiscPercentage, &u.Pb.TotalPrice,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Pb.Version, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -86,7 +90,7 @@ func (u *PurchaseReturn) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company")
+		return status.Error(codes.PermissionDenied, "its not your company")
 	}
 
 	u.Pb.ReturnDate = dateReturn.String()
@@ -98,6 +102,9 @@ func (u *PurchaseReturn) Get(ctx context.Context, db *sql.DB) error {
 		ID               string
 		PurchaseReturnID string
 		ProductID        string `json:"product_id"`
+		ProductCode      string `json:"product_code"`
+		ProductName      string `json:"product_name"`
+		ProductUnit      string `json:"product_unit"`
 		Quantity         int32
 		Price            float64
 		DiscAmount       float64 `json:"disc_amount"`
@@ -113,6 +120,9 @@ func (u *PurchaseReturn) Get(ctx context.Context, db *sql.DB) error {
 		u.Pb.Details = append(u.Pb.Details, &purchases.PurchaseReturnDetail{
 			Id:               detail.ID,
 			ProductId:        detail.ProductID,
+			ProductCode:      detail.ProductCode,
+			ProductName:      detail.ProductName,
+			ProductUnit:      detail.ProductUnit,
 			Quantity:         detail.Quantity,
 			Price:            detail.Price,
 			DiscAmount:       detail.DiscAmount,
@@ -129,7 +139,7 @@ func (u *PurchaseReturn) HasReturn(ctx context.Context, db *sql.DB) (bool, error
 	query := `
 		SELECT purchase_returns.id
 		FROM purchase_returns 
-		WHERE purchase_returns.purchase_id = $1 
+		WHERE purchase_returns.purchase_id = $1 AND purchase_returns.company_id = $2
 		LIMIT 1 OFFSET 0
 	`
 
@@ -140,7 +150,7 @@ func (u *PurchaseReturn) HasReturn(ctx context.Context, db *sql.DB) (bool, error
 	defer stmt.Close()
 
 	var myId string
-	err = stmt.QueryRowContext(ctx, u.Pb.Purchase.GetId()).Scan(&myId)
+	err = stmt.QueryRowContext(ctx, u.Pb.Purchase.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&myId)
 
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -206,12 +216,21 @@ func (u *PurchaseReturn) Create(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.Pb.Version = 1
+
+	err = writeAudit(ctx, tx, AuditPurchaseReturn, u.Pb.GetId(), auditCreate, nil)
+	if err != nil {
+		return err
+	}
 
 	for _, detail := range u.Pb.GetDetails() {
 		purchaseReturnDetailModel := PurchaseReturnDetail{}
 		purchaseReturnDetailModel.Pb = purchases.PurchaseReturnDetail{
 			PurchaseReturnId: u.Pb.GetId(),
 			ProductId:        detail.ProductId,
+			ProductCode:      detail.ProductCode,
+			ProductName:      detail.ProductName,
+			ProductUnit:      detail.ProductUnit,
 			Quantity:         detail.Quantity,
 			Price:            detail.Price,
 			DiscAmount:       detail.DiscAmount,
@@ -252,6 +271,11 @@ func (u *PurchaseReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "convert purchase return date: %v", err)
 	}
 
+	before, err := auditSnapshot(ctx, tx, AuditPurchaseReturn, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE purchase_returns SET
 		return_date = $1,
@@ -261,8 +285,9 @@ func (u *PurchaseReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		additional_disc_percentage = $5,
 		total_price = $6,
 		updated_at = $7, 
-		updated_by= $8
-		WHERE id = $9 AND purchase_id = $10
+		updated_by= $8,
+		version = version + 1
+		WHERE id = $9 AND purchase_id = $10 AND version = $11
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -270,7 +295,7 @@ func (u *PurchaseReturn) Update(ctx context.Context, tx *sql.Tx) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		dateReturn,
 		u.Pb.GetRemark(),
 		u.Pb.Price,
@@ -281,27 +306,73 @@ func (u *PurchaseReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
 		u.Pb.GetPurchase().GetId(),
+		u.Pb.GetVersion(),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update purchase return: %v", err)
 	}
 
+	if err := checkVersion(result); err != nil {
+		return err
+	}
+
 	u.Pb.UpdatedAt = now.String()
+	u.Pb.Version++
+
+	return writeAudit(ctx, tx, AuditPurchaseReturn, u.Pb.GetId(), auditUpdate, before)
+}
+
+// Lock the purchase return row until the transaction end and check it has not been changed since it was read
+func (u *PurchaseReturn) Lock(ctx context.Context, tx *sql.Tx) error {
+	var version int32
+	err := tx.QueryRowContext(ctx, `SELECT version FROM purchase_returns WHERE id = $1 AND company_id = $2 FOR UPDATE`,
+		u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&version)
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw lock purchase return: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw lock purchase return: %v", err)
+	}
+
+	if version != u.Pb.GetVersion() {
+		return ErrVersionConflict
+	}
 
 	return nil
 }
 
-// ListQuery builder
-func (u *PurchaseReturn) ListQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseReturnRequest) (string, []interface{}, *purchases.PurchaseReturnPaginationResponse, error) {
+// purchaseReturnSortFields is the sort fields of purchase return listing
+var purchaseReturnSortFields = sortFields{
+	fields: map[string]string{
+		"code":          "purchase_returns.code",
+		"return_date":   "purchase_returns.return_date",
+		"branch_name":   "purchase_returns.branch_name",
+		"purchase_code": "purchases.code",
+		"total_price":   "purchase_returns.total_price",
+		"created_at":    "purchase_returns.created_at",
+		"updated_at":    "purchase_returns.updated_at",
+	},
+	legacy:       "purchase_returns",
+	defaultField: "created_at",
+	id:           "purchase_returns.id",
+}
+
+// ListQuery builder. When scope is not nil, only purchase returns of the scope branches are listed.
+func (u *PurchaseReturn) ListQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseReturnRequest, scope *BranchScope) (string, []interface{}, *purchases.PurchaseReturnPaginationResponse, error) {
+	return u.listQuery(ctx, db, in, in.GetPagination(), scope)
+}
+
+// listQuery build the list query of the filter of in, paged and ordered by pagination
+func (u *PurchaseReturn) listQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseReturnRequest, pagination *purchases.Pagination, scope *BranchScope) (string, []interface{}, *purchases.PurchaseReturnPaginationResponse, error) {
 	var paginationResponse purchases.PurchaseReturnPaginationResponse
 	query := `
 		SELECT purchase_returns.id, purchase_returns.company_id, purchase_returns.branch_id, purchase_returns.branch_name, 
 			purchase_returns.purchase_id, purchases.code, purchase_returns.code, purchase_returns.return_date, 
 			purchase_returns.remark, purchase_returns.price, purchase_returns.additional_disc_amount, 
 			purchase_returns.additional_disc_percentage, purchase_returns.total_price,  
-			purchase_returns.created_at, purchase_returns.created_by, purchase_returns.updated_at, purchase_returns.updated_by 
-		FROM purchase_returns
-		JOIN purchases ON purchase_returns.purchase_id = purchases.id`
+			purchase_returns.created_at, purchase_returns.created_by, purchase_returns.updated_at, purchase_returns.updated_by`
+	from := `purchase_returns JOIN purchases ON purchase_returns.purchase_id = purchases.id`
 
 	where := []string{"purchase_returns.company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
@@ -311,48 +382,105 @@ func (u *PurchaseReturn) ListQuery(ctx context.Context, db *sql.DB, in *purchase
 		where = append(where, fmt.Sprintf(`purchase_returns.branch_id = $%d`, len(paramQueries)))
 	}
 
+	if scope != nil {
+		paramQueries = append(paramQueries, pq.Array(scope.BranchIds))
+		where = append(where, fmt.Sprintf(`purchase_returns.branch_id = ANY($%d::uuid[])`, len(paramQueries)))
+	}
+
 	if len(in.GetPurchaseId()) > 0 {
 		paramQueries = append(paramQueries, in.GetPurchaseId())
 		where = append(where, fmt.Sprintf(`purchase_returns.purchase_id = $%d`, len(paramQueries)))
 	}
 
-	if len(in.GetPagination().GetSearch()) > 0 {
-		paramQueries = append(paramQueries, in.GetPagination().GetSearch())
-		where = append(where, fmt.Sprintf(`(purchase_returns.code ILIKE $%d OR purchase_returns.remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	if len(in.GetSupplierId()) > 0 {
+		paramQueries = append(paramQueries, in.GetSupplierId())
+		where = append(where, fmt.Sprintf(`purchases.supplier_id = $%d`, len(paramQueries)))
 	}
 
-	{
-		qCount := `SELECT COUNT(*) FROM purchase_returns JOIN purchases ON purchase_returns.purchase_id = purchases.id`
-		if len(where) > 0 {
-			qCount += " WHERE " + strings.Join(where, " AND ")
-		}
-		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
-		if err != nil && err != sql.ErrNoRows {
-			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
-		}
+	filter := documentFilter{
+		table:         "purchase_returns",
+		dateColumn:    "return_date",
+		detailTable:   "purchase_return_details",
+		detailKey:     "purchase_return_id",
+		DateFrom:      in.GetDateFrom(),
+		DateTo:        in.GetDateTo(),
+		CreatedFrom:   in.GetCreatedFrom(),
+		CreatedTo:     in.GetCreatedTo(),
+		TotalPriceMin: in.GetTotalPriceMin(),
+		TotalPriceMax: in.GetTotalPriceMax(),
+		ProductId:     in.GetProductId(),
+		CreatedBy:     in.GetCreatedBy(),
+	}
+	where, paramQueries, err := filter.apply(where, paramQueries)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
 
-		paginationResponse.Count = uint32(count)
+	if len(pagination.GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+pagination.GetSearch()+"%")
+		where = append(where, fmt.Sprintf(`(purchase_returns.code::text ILIKE $%d OR purchase_returns.remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	}
+
+	keys, err := purchaseReturnSortFields.keyset(pagination, "")
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
+	count, estimated, err := listCount(ctx, db, from, where, paramQueries, pagination.GetCountMode())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
+	paginationResponse.Count = count
+	paginationResponse.Estimated = estimated
 
-	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "purchase_returns.code") {
-		if in.GetPagination() == nil {
-			in.Pagination = &purchases.Pagination{OrderBy: "purchase_returns.created_at"}
-		} else {
-			in.GetPagination().OrderBy = "purchase_returns.created_at"
+	if len(pagination.GetCursor()) > 0 {
+		var after string
+		after, paramQueries, err = keys.after(pagination.GetCursor(), paramQueries)
+		if err != nil {
+			return query, paramQueries, &paginationResponse, err
 		}
+		where = append(where, after)
 	}
 
-	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+	query += `, ` + keys.column() + ` cursor FROM ` + from + ` WHERE ` + strings.Join(where, " AND ")
+	query += ` ORDER BY ` + keys.orderBy()
 
-	if in.GetPagination().GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	// the offset is not used with cursor, the cursor already skip the previous rows
+	if pagination.GetLimit() > 0 {
+		paramQueries = append(paramQueries, pagination.GetLimit())
+		query += fmt.Sprintf(` LIMIT $%d`, len(paramQueries))
+		if len(pagination.GetCursor()) == 0 {
+			paramQueries = append(paramQueries, pagination.GetOffset())
+			query += fmt.Sprintf(` OFFSET $%d`, len(paramQueries))
+		}
 	}
 
 	return query, paramQueries, &paginationResponse, nil
 }
+
+// ExportQuery return the list query of the filter in the sorts of its pagination, ordered by code when there is no sort,
+// without limit. The request is not modified. With lines, every row of the list is joined with its details
+// ordered by product code, the position column keep the order of the list.
+func (u *PurchaseReturn) ExportQuery(ctx context.Context, db *sql.DB, in *purchases.ListPurchaseReturnRequest, scope *BranchScope, lines bool) (string, []interface{}, error) {
+	query, paramQueries, _, err := u.listQuery(ctx, db, in, exportPagination(in.GetPagination()), scope)
+	if err != nil {
+		return query, paramQueries, err
+	}
+
+	if !lines {
+		return query, paramQueries, nil
+	}
+
+	query = `
+		SELECT list.*, purchase_return_details.product_code, purchase_return_details.product_name, purchase_return_details.product_unit,
+			purchase_return_details.quantity, purchase_return_details.price, purchase_return_details.disc_amount,
+			purchase_return_details.disc_percentage, purchase_return_details.total_price
+		FROM (SELECT numbered.*, row_number() OVER () position FROM (` + query + `) numbered (id, company_id, branch_id, branch_name, purchase_id, purchase_code, code, return_date,
+			remark, price, additional_disc_amount, additional_disc_percentage, total_price,
+			created_at, created_by, updated_at, updated_by, cursor)) list
+		JOIN purchase_return_details ON list.id = purchase_return_details.purchase_return_id
+		ORDER BY list.position, purchase_return_details.product_code
+	`
+
+	return query, paramQueries, nil
+}
@@ -19,6 +19,7 @@ type PurchaseReturnDetail struct {
 func (u *PurchaseReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		SELECT purchase_return_details.id, purchase_returns.company_id, purchase_return_details.purchase_return_id, purchase_return_details.product_id, purchase_return_details.quantity,
+			purchase_return_details.product_code, purchase_return_details.product_name, purchase_return_details.product_unit,
 			purchase_return_details.price, purchase_return_details.disc_amount, purchase_return_details.disc_percentage, purchase_return_details.total_price
 		FROM purchase_return_details 
 		JOIN purchase_returns ON purchase_return_details.purchase_return_id = purchase_returns.id
@@ -34,6 +35,7 @@ func (u *PurchaseReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	var companyID string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetPurchaseReturnId()).Scan(
 		&u.Pb.Id, &companyID, &u.Pb.PurchaseReturnId, &u.Pb.ProductId, &u.Pb.Quantity,
+		&u.Pb.ProductCode, &u.Pb.ProductName, &u.Pb.ProductUnit,
 		&u.Pb.Price, &u.Pb.DiscAmount, &u.Pb.DiscPercentage, &u.Pb.TotalPrice,
 	)
 
@@ -46,7 +48,7 @@ func (u *PurchaseReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	}
 
 	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company")
+		return status.Error(codes.PermissionDenied, "its not your company")
 	}
 
 	return nil
@@ -55,8 +57,9 @@ func (u *PurchaseReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 func (u *PurchaseReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	query := `
-		INSERT INTO purchase_return_details (id, purchase_return_id, product_id, quantity, price, disc_amount, disc_percentage, total_price) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO purchase_return_details (id, purchase_return_id, product_id, product_code, product_name, product_unit, 
+			quantity, price, disc_amount, disc_percentage, total_price) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -68,6 +71,9 @@ func (u *PurchaseReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetId(),
 		u.Pb.GetPurchaseReturnId(),
 		u.Pb.GetProductId(),
+		u.Pb.GetProductCode(),
+		u.Pb.GetProductName(),
+		u.Pb.GetProductUnit(),
 		u.Pb.Quantity,
 		u.Pb.Price,
 		u.Pb.DiscAmount,
@@ -78,10 +84,15 @@ func (u *PurchaseReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert purchase return detail: %v", err)
 	}
 
-	return nil
+	return writeAudit(ctx, tx, AuditPurchaseReturnDetail, u.Pb.GetId(), auditCreate, nil)
 }
 
 func (u *PurchaseReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
+	before, err := auditSnapshot(ctx, tx, AuditPurchaseReturnDetail, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE purchase_return_details SET
 		quantity = $1,
@@ -103,10 +114,15 @@ func (u *PurchaseReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec update purchase return detail: %v", err)
 	}
 
-	return nil
+	return writeAudit(ctx, tx, AuditPurchaseReturnDetail, u.Pb.GetId(), auditUpdate, before)
 }
 
 func (u *PurchaseReturnDetail) Delete(ctx context.Context, tx *sql.Tx) error {
+	before, err := auditSnapshot(ctx, tx, AuditPurchaseReturnDetail, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, `DELETE FROM purchase_return_details WHERE id = $1 AND purchase_return_id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete purchase return detail: %v", err)
@@ -118,5 +134,5 @@ func (u *PurchaseReturnDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete purchase return detail: %v", err)
 	}
 
-	return nil
+	return writeAudit(ctx, tx, AuditPurchaseReturnDetail, u.Pb.GetId(), auditDelete, before)
 }
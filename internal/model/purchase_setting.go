@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PurchaseSetting is the purchase configuration of a company. Company without saved setting use the default values.
+type PurchaseSetting struct {
+	Pb purchases.PurchaseSetting
+}
+
+func (u *PurchaseSetting) Get(ctx context.Context, db *sql.DB) error {
+	query := `SELECT block_expired_document, price_variance_threshold, updated_at, updated_by FROM purchase_settings WHERE company_id = $1`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get purchase setting: %v", err)
+	}
+	defer stmt.Close()
+
+	var updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string)).Scan(
+		&u.Pb.BlockExpiredDocument, &u.Pb.PriceVarianceThreshold, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		u.Pb = purchases.PurchaseSetting{PriceVarianceThreshold: DefaultPriceVarianceThreshold}
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get purchase setting: %v", err)
+	}
+
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+func (u *PurchaseSetting) Save(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO purchase_settings (company_id, block_expired_document, price_variance_threshold, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (company_id) DO UPDATE SET
+		block_expired_document = EXCLUDED.block_expired_document,
+		price_variance_threshold = EXCLUDED.price_variance_threshold,
+		updated_at = EXCLUDED.updated_at,
+		updated_by = EXCLUDED.updated_by
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare save purchase setting: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetBlockExpiredDocument(),
+		u.Pb.GetPriceVarianceThreshold(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec save purchase setting: %v", err)
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
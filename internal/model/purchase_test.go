@@ -0,0 +1,179 @@
+package model_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/schema"
+	"github.com/jacky-htg/purchase-service/internal/service"
+	"github.com/jacky-htg/purchase-service/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testDB connect to the database of POSTGRES_* env and migrate it, the test is skipped without POSTGRES_HOST
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+
+	db, err := tenant.Open()
+	if err != nil {
+		t.Fatalf("connecting to db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := schema.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+type fakeUserClient struct {
+	users.UserServiceClient
+	user *users.User
+}
+
+func (c *fakeUserClient) View(ctx context.Context, in *users.Id, opts ...grpc.CallOption) (*users.User, error) {
+	return c.user, nil
+}
+
+type fakeBranchClient struct {
+	users.BranchServiceClient
+	branch *users.Branch
+}
+
+func (c *fakeBranchClient) View(ctx context.Context, in *users.Id, opts ...grpc.CallOption) (*users.Branch, error) {
+	return c.branch, nil
+}
+
+// fakeReceiveClient has no receiving transaction for any purchase
+type fakeReceiveClient struct {
+	inventories.ReceiveServiceClient
+}
+
+func (c *fakeReceiveClient) List(ctx context.Context, in *inventories.ListReceiveRequest, opts ...grpc.CallOption) (inventories.ReceiveService_ListClient, error) {
+	return &emptyReceiveStream{}, nil
+}
+
+type emptyReceiveStream struct {
+	grpc.ClientStream
+}
+
+func (s *emptyReceiveStream) Recv() (*inventories.ListReceiveResponse, error) {
+	return nil, io.EOF
+}
+
+// TestPurchaseReturnCreateConcurrent return the same purchase from many requests at once,
+// the returned quantity must never exceed the purchased quantity.
+func TestPurchaseReturnCreateConcurrent(t *testing.T) {
+	db := testDB(t)
+
+	const purchasedQty, returnQty, requests = 10, 3, 10
+	companyID, userID, branchID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	supplierID, purchaseID, productID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), companyID)
+	ctx = context.WithValue(ctx, app.Ctx("userID"), userID)
+
+	setup := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO suppliers (id, company_id, code, name, address, phone, created_by, updated_by)
+			VALUES ($1, $2, 'SUP-TEST', $3, '', '', $4, $4)`, []interface{}{supplierID, companyID, "test " + supplierID[:8], userID}},
+		{`INSERT INTO purchases (id, company_id, branch_id, branch_name, supplier_id, code, purchase_date, remark, price, total_price, created_by, updated_by)
+			VALUES ($1, $2, $3, 'Test', $4, 'PO-TEST', '2024-08-01', '', 1000, 1000, $5, $5)`, []interface{}{purchaseID, companyID, branchID, supplierID, userID}},
+		{`INSERT INTO purchase_details (id, purchase_id, product_id, price, quantity, total_price)
+			VALUES ($1, $2, $3, 100, $4, 1000)`, []interface{}{uuid.New().String(), purchaseID, productID, purchasedQty}},
+	}
+	for _, s := range setup {
+		if _, err := db.ExecContext(ctx, s.query, s.args...); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, s := range []struct {
+			query string
+			id    string
+		}{
+			{`DELETE FROM purchase_returns WHERE purchase_id = $1`, purchaseID},
+			{`DELETE FROM purchases WHERE id = $1`, purchaseID},
+			{`DELETE FROM suppliers WHERE id = $1`, supplierID},
+			{`DELETE FROM audit_logs WHERE company_id = $1`, companyID},
+		} {
+			if _, err := db.ExecContext(ctx, s.query, s.id); err != nil {
+				t.Errorf("cleanup: %v", err)
+			}
+		}
+	})
+
+	purchaseReturnServer := &service.PurchaseReturn{
+		Db:            db,
+		UserClient:    &fakeUserClient{user: &users.User{Id: userID, BranchId: branchID}},
+		BranchClient:  &fakeBranchClient{branch: &users.Branch{Id: branchID, Name: "Test"}},
+		ReceiveClient: &fakeReceiveClient{},
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := purchaseReturnServer.PurchaseReturnCreate(ctx, &purchases.PurchaseReturn{
+				BranchId:   branchID,
+				Purchase:   &purchases.Purchase{Id: purchaseID},
+				ReturnDate: "2024-08-02T00:00:00.000Z",
+				Details:    []*purchases.PurchaseReturnDetail{{ProductId: productID, Quantity: returnQty}},
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch status.Code(err) {
+			case codes.OK:
+				created++
+			case codes.FailedPrecondition, codes.InvalidArgument:
+				// rejected because the outstanding is not enough
+			default:
+				t.Errorf("PurchaseReturnCreate: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var returned int
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(purchase_return_details.quantity), 0)
+		FROM purchase_returns
+		JOIN purchase_return_details ON purchase_returns.id = purchase_return_details.purchase_return_id
+		WHERE purchase_returns.purchase_id = $1`, purchaseID).Scan(&returned)
+	if err != nil {
+		t.Fatalf("query returned quantity: %v", err)
+	}
+
+	if returned > purchasedQty {
+		t.Errorf("returned quantity %d exceed purchased quantity %d", returned, purchasedQty)
+	}
+
+	if returned != created*returnQty {
+		t.Errorf("returned quantity %d, want %d from %d created returns", returned, created*returnQty, created)
+	}
+
+	if created != purchasedQty/returnQty {
+		t.Errorf("created %d returns, want %d", created, purchasedQty/returnQty)
+	}
+}
@@ -15,8 +15,8 @@ type Receive struct {
 
 func (u *Receive) HasTransactionByPurchase(ctx context.Context, purchaseId string) (bool, error) {
 	streamClient, err := u.Client.List(ctx, &inventories.ListReceiveRequest{PurchaseId: purchaseId})
-	if s, ok := status.FromError(err); !ok {
-		if s.Code() == codes.Unknown {
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
 			err = status.Errorf(codes.Internal, "Error when calling Purchase.HasTreansaction service: %s", err)
 		}
 
@@ -42,3 +42,29 @@ func (u *Receive) HasTransactionByPurchase(ctx context.Context, purchaseId strin
 
 	return false, nil
 }
+
+func (u *Receive) ListByPurchase(ctx context.Context, purchaseId string) ([]*inventories.Receive, error) {
+	var list []*inventories.Receive
+	streamClient, err := u.Client.List(ctx, &inventories.ListReceiveRequest{PurchaseId: purchaseId})
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
+			err = status.Errorf(codes.Internal, "Error when calling Receive.List service: %s", err)
+		}
+
+		return list, err
+	}
+
+	for {
+		resp, err := streamClient.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "cannot receive %v", err)
+		}
+
+		list = append(list, resp.GetReceive())
+	}
+
+	return list, nil
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+)
+
+type Region struct {
+	RegionClient users.RegionServiceClient
+	Pb           *users.Region
+	Id           string
+}
+
+func (u *Region) Get(ctx context.Context) error {
+	region, err := getRegion(ctx, u.RegionClient, &users.Region{Id: u.Id})
+	if err != nil {
+		return err
+	}
+	u.Pb = region
+
+	return nil
+}
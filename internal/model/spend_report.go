@@ -0,0 +1,177 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SpendReport aggregate purchase spend dated between DateFrom and DateTo, net of purchase returns.
+// Returns are counted at their return date. The additional discount of the document is spread over its lines
+// by line amount, so amounts grouped by product add up to the document totals.
+type SpendReport struct {
+	DateFrom    time.Time
+	DateTo      time.Time
+	BranchIds   []string
+	SupplierIds []string
+	GroupBy     []purchases.SpendDimension
+	Period      purchases.SpendPeriod
+	// Scope limit the report to the branches of the user login, nil means all branches
+	Scope *BranchScope
+}
+
+// spendPeriods map the period granularity to date_trunc field
+var spendPeriods = map[purchases.SpendPeriod]string{
+	purchases.SpendPeriod_DAY:     "day",
+	purchases.SpendPeriod_WEEK:    "week",
+	purchases.SpendPeriod_MONTH:   "month",
+	purchases.SpendPeriod_QUARTER: "quarter",
+}
+
+func (u *SpendReport) Calculate(ctx context.Context, db *sql.DB) (*purchases.SpendReport, error) {
+	output := &purchases.SpendReport{DateFrom: u.DateFrom.String(), DateTo: u.DateTo.String()}
+
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.DateFrom, u.DateTo}
+	var purchaseFilter, returnFilter string
+	if len(u.BranchIds) > 0 {
+		paramQueries = append(paramQueries, pq.Array(u.BranchIds))
+		purchaseFilter += fmt.Sprintf(" AND purchases.branch_id = ANY($%d::uuid[])", len(paramQueries))
+		returnFilter += fmt.Sprintf(" AND purchase_returns.branch_id = ANY($%d::uuid[])", len(paramQueries))
+	}
+
+	if u.Scope != nil {
+		paramQueries = append(paramQueries, pq.Array(u.Scope.BranchIds))
+		purchaseFilter += fmt.Sprintf(" AND purchases.branch_id = ANY($%d::uuid[])", len(paramQueries))
+		returnFilter += fmt.Sprintf(" AND purchase_returns.branch_id = ANY($%d::uuid[])", len(paramQueries))
+	}
+
+	if len(u.SupplierIds) > 0 {
+		paramQueries = append(paramQueries, pq.Array(u.SupplierIds))
+		purchaseFilter += fmt.Sprintf(" AND purchases.supplier_id = ANY($%d::uuid[])", len(paramQueries))
+		returnFilter += fmt.Sprintf(" AND purchases.supplier_id = ANY($%d::uuid[])", len(paramQueries))
+	}
+
+	// every dimension is selected so the scan is the same, the dimensions not grouped are selected as empty string
+	period, supplierID, supplierCode, supplierName := "''", "''", "''", "''"
+	branchID, branchName, productID, productCode, productName := "''", "''", "''", "''", "''"
+	var groups []string
+	joinSupplier := ""
+
+	if field, ok := spendPeriods[u.Period]; ok {
+		period = fmt.Sprintf("to_char(date_trunc('%s', lines.doc_date), 'YYYY-MM-DD')", field)
+		groups = append(groups, period)
+	}
+
+	for _, dimension := range u.GroupBy {
+		switch dimension {
+		case purchases.SpendDimension_SUPPLIER:
+			supplierID, supplierCode, supplierName = "suppliers.id::text", "MAX(suppliers.code)", "MAX(suppliers.name)"
+			joinSupplier = "JOIN suppliers ON lines.supplier_id = suppliers.id"
+			groups = append(groups, "suppliers.id")
+		case purchases.SpendDimension_BRANCH:
+			branchID, branchName = "lines.branch_id::text", "MAX(lines.branch_name)"
+			groups = append(groups, "lines.branch_id")
+		case purchases.SpendDimension_PRODUCT:
+			productID, productCode, productName = "lines.product_id::text", "MAX(lines.product_code)", "MAX(lines.product_name)"
+			groups = append(groups, "lines.product_id")
+		}
+	}
+
+	// the total is computed by the empty grouping set, it is the row where GROUPING of the grouped columns is not zero
+	grouping := "GROUP BY ()"
+	isTotal := "true"
+	orderBy := ""
+	if len(groups) > 0 {
+		grouping = fmt.Sprintf("GROUP BY GROUPING SETS ((%s), ())", strings.Join(groups, ", "))
+		isTotal = fmt.Sprintf("GROUPING(%s) > 0", strings.Join(groups, ", "))
+		orderBy = fmt.Sprintf("ORDER BY %s, %s", isTotal, strings.Join(groups, ", "))
+	}
+
+	query := `
+		WITH lines AS (
+			SELECT 'purchase' kind, purchases.id doc_id, purchases.purchase_date doc_date,
+				purchases.branch_id, purchases.branch_name, purchases.supplier_id,
+				purchase_details.product_id, purchase_details.product_code, purchase_details.product_name, purchase_details.quantity,
+				purchase_details.total_price * CASE WHEN purchases.price = 0 THEN 1 ELSE purchases.total_price / purchases.price END amount
+			FROM purchases
+			JOIN purchase_details ON purchases.id = purchase_details.purchase_id
+			WHERE purchases.company_id = $1 AND purchases.purchase_date BETWEEN $2 AND $3 ` + purchaseFilter + `
+			UNION ALL
+			SELECT 'return' kind, purchase_returns.id doc_id, purchase_returns.return_date doc_date,
+				purchase_returns.branch_id, purchase_returns.branch_name, purchases.supplier_id,
+				purchase_return_details.product_id, purchase_return_details.product_code, purchase_return_details.product_name, purchase_return_details.quantity,
+				purchase_return_details.total_price * CASE WHEN purchase_returns.price = 0 THEN 1 ELSE purchase_returns.total_price / purchase_returns.price END amount
+			FROM purchase_returns
+			JOIN purchases ON purchase_returns.purchase_id = purchases.id
+			JOIN purchase_return_details ON purchase_returns.id = purchase_return_details.purchase_return_id
+			WHERE purchase_returns.company_id = $1 AND purchase_returns.return_date BETWEEN $2 AND $3 ` + returnFilter + `
+		)
+		SELECT ` + isTotal + `, ` + period + `, ` + supplierID + `, ` + supplierCode + `, ` + supplierName + `,
+			` + branchID + `, ` + branchName + `, ` + productID + `, ` + productCode + `, ` + productName + `,
+			COUNT(DISTINCT lines.doc_id) FILTER (WHERE lines.kind = 'purchase'),
+			COALESCE(SUM(lines.quantity) FILTER (WHERE lines.kind = 'purchase'), 0),
+			COALESCE(SUM(lines.amount) FILTER (WHERE lines.kind = 'purchase'), 0),
+			COUNT(DISTINCT lines.doc_id) FILTER (WHERE lines.kind = 'return'),
+			COALESCE(SUM(lines.quantity) FILTER (WHERE lines.kind = 'return'), 0),
+			COALESCE(SUM(lines.amount) FILTER (WHERE lines.kind = 'return'), 0)
+		FROM lines ` + joinSupplier + `
+		` + grouping + `
+		` + orderBy
+
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return output, status.Errorf(codes.Internal, "Query spend report: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total bool
+		var row purchases.SpendRow
+		// the grouped columns are null in the total row
+		var dimensions [9]sql.NullString
+		err = rows.Scan(&total, &dimensions[0], &dimensions[1], &dimensions[2], &dimensions[3],
+			&dimensions[4], &dimensions[5], &dimensions[6], &dimensions[7], &dimensions[8],
+			&row.PurchaseCount, &row.PurchaseQuantity, &row.PurchaseAmount,
+			&row.ReturnCount, &row.ReturnQuantity, &row.ReturnAmount)
+		if err != nil {
+			return output, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		row.NetQuantity = row.GetPurchaseQuantity() - row.GetReturnQuantity()
+		row.NetAmount = row.GetPurchaseAmount() - row.GetReturnAmount()
+
+		if total {
+			output.Total = &row
+			continue
+		}
+
+		row.Period = dimensions[0].String
+		row.SupplierId = dimensions[1].String
+		row.SupplierCode = dimensions[2].String
+		row.SupplierName = dimensions[3].String
+		row.BranchId = dimensions[4].String
+		row.BranchName = dimensions[5].String
+		row.ProductId = dimensions[6].String
+		row.ProductCode = dimensions[7].String
+		row.ProductName = dimensions[8].String
+		output.Rows = append(output.Rows, &row)
+	}
+
+	if rows.Err() != nil {
+		return output, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	if output.Total == nil {
+		output.Total = &purchases.SpendRow{}
+	}
+
+	return output, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -20,7 +21,7 @@ type Supplier struct {
 
 func (u *Supplier) Get(ctx context.Context, db *sql.DB) error {
 	query := `
-		SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, code, name, address, phone, npwp, status, blocked_reason, created_at, created_by, updated_at, updated_by, version
 		FROM suppliers WHERE id = $1 AND company_id = $2
 	`
 
@@ -30,10 +31,11 @@ func (u *Supplier) Get(ctx context.Context, db *sql.DB) error {
 	}
 	defer stmt.Close()
 
-	var companyID string
+	var companyID, supplierStatus string
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &u.Pb.Npwp, &supplierStatus, &u.Pb.BlockedReason,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Pb.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -45,18 +47,19 @@ func (u *Supplier) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company data")
+		return status.Error(codes.PermissionDenied, "its not your company data")
 	}
 
+	u.Pb.Status = SupplierStatusFromString(supplierStatus)
 	u.Pb.CreatedAt = createdAt.String()
 	u.Pb.UpdatedAt = updatedAt.String()
 
-	return nil
+	return u.getBranches(ctx, db)
 }
 
 func (u *Supplier) GetByCode(ctx context.Context, db *sql.DB) error {
 	query := `
-		SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, code, name, address, phone, npwp, status, blocked_reason, created_at, created_by, updated_at, updated_by, version
 		FROM suppliers WHERE company_id = $1 AND code = $2
 	`
 
@@ -66,10 +69,11 @@ func (u *Supplier) GetByCode(ctx context.Context, db *sql.DB) error {
 	}
 	defer stmt.Close()
 
-	var companyID string
+	var companyID, supplierStatus string
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetCode()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &u.Pb.Npwp, &supplierStatus, &u.Pb.BlockedReason,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Pb.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -80,23 +84,26 @@ func (u *Supplier) GetByCode(ctx context.Context, db *sql.DB) error {
 		return status.Errorf(codes.Internal, "Query Raw get supplier by code: %v", err)
 	}
 
+	u.Pb.Status = SupplierStatusFromString(supplierStatus)
 	u.Pb.CreatedAt = createdAt.String()
 	u.Pb.UpdatedAt = updatedAt.String()
 
 	return nil
 }
 
-func (u *Supplier) Create(ctx context.Context, db *sql.DB) error {
+func (u *Supplier) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.Status = purchases.SupplierStatus_ACTIVE
+	u.Pb.BlockedReason = ""
 
 	query := `
-		INSERT INTO suppliers (id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO suppliers (id, company_id, code, name, address, phone, npwp, status, blocked_reason, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert supplier: %v", err)
 	}
@@ -109,6 +116,9 @@ func (u *Supplier) Create(ctx context.Context, db *sql.DB) error {
 		u.Pb.GetName(),
 		u.Pb.GetAddress(),
 		u.Pb.GetPhone(),
+		u.Pb.GetNpwp(),
+		supplierStatusToString(u.Pb.GetStatus()),
+		u.Pb.GetBlockedReason(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -120,49 +130,170 @@ func (u *Supplier) Create(ctx context.Context, db *sql.DB) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.Pb.Version = 1
 
-	return nil
+	return writeAudit(ctx, tx, AuditSupplier, u.Pb.GetId(), auditCreate, nil)
 }
 
-func (u *Supplier) Update(ctx context.Context, db *sql.DB) error {
+func (u *Supplier) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
+	before, err := auditSnapshot(ctx, tx, AuditSupplier, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE suppliers SET
 		name = $1,
 		address = $2,
 		phone = $3, 
-		updated_at = $4, 
-		updated_by= $5
-		WHERE id = $6 AND company_id = $7
+		npwp = $4,
+		updated_at = $5, 
+		updated_by= $6,
+		version = version + 1
+		WHERE id = $7 AND company_id = $8 AND version = $9
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update supplier: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		u.Pb.GetName(),
 		u.Pb.GetAddress(),
 		u.Pb.GetPhone(),
+		u.Pb.GetNpwp(),
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
 		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetVersion(),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update supplier: %v", err)
 	}
 
+	if err := checkVersion(result); err != nil {
+		return err
+	}
+
 	u.Pb.UpdatedAt = now.String()
+	u.Pb.Version++
+
+	return writeAudit(ctx, tx, AuditSupplier, u.Pb.GetId(), auditUpdate, before)
+}
+
+func (u *Supplier) ChangeStatus(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	if u.Pb.GetStatus() != purchases.SupplierStatus_BLOCKED {
+		u.Pb.BlockedReason = ""
+	}
+
+	before, err := auditSnapshot(ctx, tx, AuditSupplier, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE suppliers SET
+		status = $1,
+		blocked_reason = $2,
+		updated_at = $3,
+		updated_by = $4,
+		version = version + 1
+		WHERE id = $5 AND company_id = $6 AND version = $7
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare change status supplier: %v", err)
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		supplierStatusToString(u.Pb.GetStatus()),
+		u.Pb.GetBlockedReason(),
+		now,
+		u.Pb.GetUpdatedBy(),
+		u.Pb.GetId(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetVersion(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec change status supplier: %v", err)
+	}
+
+	if err := checkVersion(result); err != nil {
+		return err
+	}
+
+	u.Pb.UpdatedAt = now.String()
+	u.Pb.Version++
+
+	return writeAudit(ctx, tx, AuditSupplier, u.Pb.GetId(), auditUpdate, before)
+}
+
+// Lock the supplier row until the transaction end and check it has not been changed since it was read.
+// A purchase referencing the supplier can not be created by other transaction while the row is locked.
+func (u *Supplier) Lock(ctx context.Context, tx *sql.Tx) error {
+	var version int32
+	err := tx.QueryRowContext(ctx, `SELECT version FROM suppliers WHERE id = $1 AND company_id = $2 FOR UPDATE`,
+		u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&version)
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw lock supplier: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw lock supplier: %v", err)
+	}
+
+	if version != u.Pb.GetVersion() {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+func (u *Supplier) HasPurchase(ctx context.Context, tx *sql.Tx) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM purchases WHERE supplier_id = $1 AND company_id = $2)`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Prepare statement 'Has Purchase' supplier: %v", err)
+	}
+	defer stmt.Close()
+
+	var hasPurchase bool
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&hasPurchase)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Query Raw 'Has Purchase' supplier: %v", err)
+	}
+
+	return hasPurchase, nil
+}
+
+// IsActive validate the supplier can be used for a new transaction
+func (u *Supplier) IsActive() error {
+	switch u.Pb.GetStatus() {
+	case purchases.SupplierStatus_INACTIVE:
+		return status.Error(codes.FailedPrecondition, "supplier is inactive")
+	case purchases.SupplierStatus_BLOCKED:
+		return status.Errorf(codes.FailedPrecondition, "supplier is blocked: %s", u.Pb.GetBlockedReason())
+	}
 
 	return nil
 }
 
-func (u *Supplier) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM suppliers WHERE company_id = $1 AND id = $2`)
+func (u *Supplier) Delete(ctx context.Context, tx *sql.Tx) error {
+	before, err := auditSnapshot(ctx, tx, AuditSupplier, u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM suppliers WHERE company_id = $1 AND id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete supplier: %v", err)
 	}
@@ -173,52 +304,205 @@ func (u *Supplier) Delete(ctx context.Context, db *sql.DB) error {
 		return status.Errorf(codes.Internal, "Exec delete supplier: %v", err)
 	}
 
+	return writeAudit(ctx, tx, AuditSupplier, u.Pb.GetId(), auditDelete, before)
+}
+
+// SaveBranches replace the branches and regions the supplier is available for. Empty both means available for all branches.
+func (u *Supplier) SaveBranches(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range []string{"supplier_branches", "supplier_regions"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE supplier_id = $1`, u.Pb.GetId()); err != nil {
+			return status.Errorf(codes.Internal, "Exec delete %s: %v", table, err)
+		}
+	}
+
+	for _, branchID := range u.Pb.GetBranchIds() {
+		_, err := tx.ExecContext(ctx, `INSERT INTO supplier_branches (supplier_id, branch_id) VALUES ($1, $2)`, u.Pb.GetId(), branchID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec insert supplier branch: %v", err)
+		}
+	}
+
+	for _, regionID := range u.Pb.GetRegionIds() {
+		_, err := tx.ExecContext(ctx, `INSERT INTO supplier_regions (supplier_id, region_id) VALUES ($1, $2)`, u.Pb.GetId(), regionID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec insert supplier region: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// IsAvailable check the supplier can be used by the branch of the region
+func (u *Supplier) IsAvailable(branchID, regionID string) bool {
+	if len(u.Pb.GetBranchIds()) == 0 && len(u.Pb.GetRegionIds()) == 0 {
+		return true
+	}
+
+	return contains(u.Pb.GetBranchIds(), branchID) || contains(u.Pb.GetRegionIds(), regionID)
+}
+
+// IsVisible check the supplier is available for any branch or region of the scope
+func (u *Supplier) IsVisible(scope *BranchScope) bool {
+	if scope == nil || (len(u.Pb.GetBranchIds()) == 0 && len(u.Pb.GetRegionIds()) == 0) {
+		return true
+	}
+
+	for _, branchID := range scope.BranchIds {
+		if contains(u.Pb.GetBranchIds(), branchID) {
+			return true
+		}
+	}
+
+	for _, regionID := range scope.RegionIds {
+		if contains(u.Pb.GetRegionIds(), regionID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *Supplier) getBranches(ctx context.Context, db *sql.DB) error {
+	u.Pb.BranchIds = nil
+	u.Pb.RegionIds = nil
+
+	query := `
+		SELECT 'branch', branch_id FROM supplier_branches WHERE supplier_id = $1
+		UNION ALL
+		SELECT 'region', region_id FROM supplier_regions WHERE supplier_id = $1
+	`
+	rows, err := db.QueryContext(ctx, query, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query supplier branches: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, id string
+		if err := rows.Scan(&kind, &id); err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		if kind == "branch" {
+			u.Pb.BranchIds = append(u.Pb.BranchIds, id)
+		} else {
+			u.Pb.RegionIds = append(u.Pb.RegionIds, id)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
 	return nil
 }
 
-func (u *Supplier) ListQuery(ctx context.Context, db *sql.DB, in *purchases.Pagination) (string, []interface{}, *purchases.SupplierPaginationResponse, error) {
+// supplierSortFields is the sort fields of supplier listing
+var supplierSortFields = sortFields{
+	fields: map[string]string{
+		"code":       "suppliers.code",
+		"name":       "suppliers.name",
+		"status":     "suppliers.status",
+		"created_at": "suppliers.created_at",
+		"updated_at": "suppliers.updated_at",
+	},
+	legacy:       "suppliers",
+	defaultField: "created_at",
+	id:           "suppliers.id",
+}
+
+// ListQuery build list query of suppliers. When scope is not nil, only suppliers available for the scope are listed.
+func (u *Supplier) ListQuery(ctx context.Context, db *sql.DB, in *purchases.ListSupplierRequest, scope *BranchScope) (string, []interface{}, *purchases.SupplierPaginationResponse, error) {
 	var paginationResponse purchases.SupplierPaginationResponse
-	query := `SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by FROM suppliers`
+	query := `SELECT id, company_id, code, name, address, phone, npwp, status, blocked_reason, created_at, created_by, updated_at, updated_by`
+	from := `suppliers`
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
 
-	if len(in.GetSearch()) > 0 {
-		paramQueries = append(paramQueries, "%"+in.GetSearch()+"%")
-		where = append(where, fmt.Sprintf(`(name ILIKE $%d OR code ILIKE $%d OR address ILIKE $%d OR phone ILIKE $%d)`, len(paramQueries), len(paramQueries), len(paramQueries), len(paramQueries)))
+	if len(in.GetStatuses()) > 0 {
+		var statuses []string
+		for _, supplierStatus := range in.GetStatuses() {
+			statuses = append(statuses, supplierStatusToString(supplierStatus))
+		}
+		paramQueries = append(paramQueries, pq.Array(statuses))
+		where = append(where, fmt.Sprintf(`status = ANY($%d)`, len(paramQueries)))
 	}
 
-	{
-		qCount := `SELECT COUNT(*) FROM suppliers`
-		if len(where) > 0 {
-			qCount += " WHERE " + strings.Join(where, " AND ")
-		}
-		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
-		if err != nil && err != sql.ErrNoRows {
-			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
-		}
+	if scope != nil {
+		paramQueries = append(paramQueries, pq.Array(scope.BranchIds), pq.Array(scope.RegionIds))
+		where = append(where, fmt.Sprintf(`(
+			(NOT EXISTS (SELECT 1 FROM supplier_branches WHERE supplier_id = suppliers.id)
+				AND NOT EXISTS (SELECT 1 FROM supplier_regions WHERE supplier_id = suppliers.id))
+			OR EXISTS (SELECT 1 FROM supplier_branches WHERE supplier_id = suppliers.id AND branch_id = ANY($%d::uuid[]))
+			OR EXISTS (SELECT 1 FROM supplier_regions WHERE supplier_id = suppliers.id AND region_id = ANY($%d::uuid[]))
+		)`, len(paramQueries)-1, len(paramQueries)))
+	}
 
-		paginationResponse.Count = uint32(count)
+	// the search match the words of code, name and address, the code, phone and npwp also match by trigram
+	var rank string
+	if len(in.GetPagination().GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
+		condition := fmt.Sprintf(`code::text ILIKE $%d OR phone ILIKE $%d OR npwp ILIKE $%d`, len(paramQueries), len(paramQueries), len(paramQueries))
+		if tsquery := searchQuery(in.GetPagination().GetSearch()); len(tsquery) > 0 {
+			paramQueries = append(paramQueries, tsquery)
+			condition = fmt.Sprintf(`search_vector @@ to_tsquery('simple', $%d) OR %s`, len(paramQueries), condition)
+			rank = fmt.Sprintf(`ts_rank(suppliers.search_vector, to_tsquery('simple', $%d))`, len(paramQueries))
+		}
+		where = append(where, "("+condition+")")
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
+	keys, err := supplierSortFields.keyset(in.GetPagination(), rank)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	if len(in.GetOrderBy()) == 0 || !(in.GetOrderBy() == "name" || in.GetOrderBy() == "code") {
-		if in == nil {
-			in = &purchases.Pagination{OrderBy: "created_at"}
-		} else {
-			in.OrderBy = "created_at"
+	count, estimated, err := listCount(ctx, db, from, where, paramQueries, in.GetPagination().GetCountMode())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
+	paginationResponse.Count = count
+	paginationResponse.Estimated = estimated
+
+	if len(in.GetPagination().GetCursor()) > 0 {
+		var after string
+		after, paramQueries, err = keys.after(in.GetPagination().GetCursor(), paramQueries)
+		if err != nil {
+			return query, paramQueries, &paginationResponse, err
 		}
+		where = append(where, after)
 	}
 
-	query += ` ORDER BY ` + in.GetOrderBy() + ` ` + in.GetSort().String()
+	query += `, ` + keys.column() + ` cursor FROM ` + from + ` WHERE ` + strings.Join(where, " AND ")
+	query += ` ORDER BY ` + keys.orderBy()
 
-	if in.GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetLimit(), in.GetOffset())
+	// the offset is not used with cursor, the cursor already skip the previous rows
+	if in.GetPagination().GetLimit() > 0 {
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit())
+		query += fmt.Sprintf(` LIMIT $%d`, len(paramQueries))
+		if len(in.GetPagination().GetCursor()) == 0 {
+			paramQueries = append(paramQueries, in.GetPagination().GetOffset())
+			query += fmt.Sprintf(` OFFSET $%d`, len(paramQueries))
+		}
 	}
 
 	return query, paramQueries, &paginationResponse, nil
 }
+
+// SupplierStatusFromString convert value of suppliers.status column into protobuf enum
+func SupplierStatusFromString(s string) purchases.SupplierStatus {
+	return purchases.SupplierStatus(purchases.SupplierStatus_value[strings.ToUpper(s)])
+}
+
+func supplierStatusToString(s purchases.SupplierStatus) string {
+	return strings.ToLower(s.String())
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type SupplierAddress struct {
+	Pb purchases.SupplierAddress
+}
+
+func (u *SupplierAddress) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT supplier_addresses.id, suppliers.company_id, supplier_addresses.supplier_id, supplier_addresses.type,
+			supplier_addresses.address, supplier_addresses.city, supplier_addresses.postal_code,
+			supplier_addresses.created_at, supplier_addresses.created_by, supplier_addresses.updated_at, supplier_addresses.updated_by
+		FROM supplier_addresses
+		JOIN suppliers ON supplier_addresses.supplier_id = suppliers.id
+		WHERE supplier_addresses.id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get supplier address: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID, addressType string
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.SupplierId, &addressType, &u.Pb.Address, &u.Pb.City, &u.Pb.PostalCode,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get supplier address: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get supplier address: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.PermissionDenied, "its not your company data")
+	}
+
+	u.Pb.Type = purchases.SupplierAddressType(purchases.SupplierAddressType_value[strings.ToUpper(addressType)])
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+func (u *SupplierAddress) List(ctx context.Context, db *sql.DB, supplierID string) ([]*purchases.SupplierAddress, error) {
+	var list []*purchases.SupplierAddress
+	query := `
+		SELECT id, supplier_id, type, address, city, postal_code, created_at, created_by, updated_at, updated_by
+		FROM supplier_addresses WHERE supplier_id = $1
+		ORDER BY type, created_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, supplierID)
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list supplier address: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pbAddress purchases.SupplierAddress
+		var addressType string
+		var createdAt, updatedAt time.Time
+		err = rows.Scan(
+			&pbAddress.Id, &pbAddress.SupplierId, &addressType, &pbAddress.Address, &pbAddress.City, &pbAddress.PostalCode,
+			&createdAt, &pbAddress.CreatedBy, &updatedAt, &pbAddress.UpdatedBy,
+		)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbAddress.Type = purchases.SupplierAddressType(purchases.SupplierAddressType_value[strings.ToUpper(addressType)])
+		pbAddress.CreatedAt = createdAt.String()
+		pbAddress.UpdatedAt = updatedAt.String()
+		list = append(list, &pbAddress)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+func (u *SupplierAddress) Create(ctx context.Context, db *sql.DB) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO supplier_addresses (id, supplier_id, type, address, city, postal_code, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert supplier address: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetSupplierId(),
+		strings.ToLower(u.Pb.GetType().String()),
+		u.Pb.GetAddress(),
+		u.Pb.GetCity(),
+		u.Pb.GetPostalCode(),
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert supplier address: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	return nil
+}
+
+func (u *SupplierAddress) Update(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		UPDATE supplier_addresses SET
+		type = $1,
+		address = $2,
+		city = $3,
+		postal_code = $4,
+		updated_at = $5,
+		updated_by = $6
+		WHERE id = $7
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare update supplier address: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		strings.ToLower(u.Pb.GetType().String()),
+		u.Pb.GetAddress(),
+		u.Pb.GetCity(),
+		u.Pb.GetPostalCode(),
+		now,
+		u.Pb.GetUpdatedBy(),
+		u.Pb.GetId(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update supplier address: %v", err)
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+func (u *SupplierAddress) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM supplier_addresses WHERE id = $1`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete supplier address: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete supplier address: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupplierBankAccount model. Every new, changed or removed bank account is stored as pending request
+// and only takes effect after it is confirmed by another user.
+type SupplierBankAccount struct {
+	Pb purchases.SupplierBankAccount
+}
+
+func (u *SupplierBankAccount) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT supplier_bank_accounts.id, suppliers.company_id, supplier_bank_accounts.supplier_id,
+			supplier_bank_accounts.bank_name, supplier_bank_accounts.account_number, supplier_bank_accounts.account_name,
+			supplier_bank_accounts.status, supplier_bank_accounts.replace_id, supplier_bank_accounts.removal,
+			supplier_bank_accounts.requested_at, supplier_bank_accounts.requested_by,
+			supplier_bank_accounts.confirmed_at, supplier_bank_accounts.confirmed_by
+		FROM supplier_bank_accounts
+		JOIN suppliers ON supplier_bank_accounts.supplier_id = suppliers.id
+		WHERE supplier_bank_accounts.id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get supplier bank account: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	err = u.scan(stmt.QueryRowContext(ctx, u.Pb.GetId()), &companyID)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get supplier bank account: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get supplier bank account: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.PermissionDenied, "its not your company data")
+	}
+
+	return nil
+}
+
+func (u *SupplierBankAccount) List(ctx context.Context, db *sql.DB, supplierID string) ([]*purchases.SupplierBankAccount, error) {
+	var list []*purchases.SupplierBankAccount
+	query := `
+		SELECT supplier_bank_accounts.id, suppliers.company_id, supplier_bank_accounts.supplier_id,
+			supplier_bank_accounts.bank_name, supplier_bank_accounts.account_number, supplier_bank_accounts.account_name,
+			supplier_bank_accounts.status, supplier_bank_accounts.replace_id, supplier_bank_accounts.removal,
+			supplier_bank_accounts.requested_at, supplier_bank_accounts.requested_by,
+			supplier_bank_accounts.confirmed_at, supplier_bank_accounts.confirmed_by
+		FROM supplier_bank_accounts
+		JOIN suppliers ON supplier_bank_accounts.supplier_id = suppliers.id
+		WHERE supplier_bank_accounts.supplier_id = $1 AND suppliers.company_id = $2
+		ORDER BY supplier_bank_accounts.requested_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, supplierID, ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list supplier bank account: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bankAccount SupplierBankAccount
+		var companyID string
+		err = bankAccount.scan(rows, &companyID)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		list = append(list, &bankAccount.Pb)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+// Create request a new bank account. When ReplaceId is filled, the request will replace that account after confirmation,
+// or remove it when Removal is set. An account can only have one pending request.
+func (u *SupplierBankAccount) Create(ctx context.Context, db *sql.DB) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.RequestedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.Status = purchases.SupplierBankAccountStatus_PENDING
+	u.Pb.ConfirmedBy = ""
+	u.Pb.ConfirmedAt = ""
+
+	var replaceID sql.NullString
+	if len(u.Pb.GetReplaceId()) > 0 {
+		replaceID = sql.NullString{String: u.Pb.GetReplaceId(), Valid: true}
+	}
+
+	query := `
+		INSERT INTO supplier_bank_accounts (id, supplier_id, bank_name, account_number, account_name, status, replace_id, removal, requested_at, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert supplier bank account: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetSupplierId(),
+		u.Pb.GetBankName(),
+		u.Pb.GetAccountNumber(),
+		u.Pb.GetAccountName(),
+		strings.ToLower(u.Pb.GetStatus().String()),
+		replaceID,
+		u.Pb.GetRemoval(),
+		now,
+		u.Pb.GetRequestedBy(),
+	)
+	// unique_violation of supplier_bank_accounts_pending_replace_idx, another request was created at the same time
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return status.Error(codes.FailedPrecondition, "bank account already has a pending request")
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert supplier bank account: %v", err)
+	}
+
+	u.Pb.RequestedAt = now.String()
+
+	return nil
+}
+
+// Confirm activate pending bank account and remove the account it replaces.
+// A removal request is deleted together with the account it removes.
+func (u *SupplierBankAccount) Confirm(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.ConfirmedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	stmt, err := tx.PrepareContext(ctx, `
+		UPDATE supplier_bank_accounts SET
+		status = $1,
+		confirmed_at = $2,
+		confirmed_by = $3
+		WHERE id = $4 AND status = $5
+	`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare confirm supplier bank account: %v", err)
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		strings.ToLower(purchases.SupplierBankAccountStatus_ACTIVE.String()),
+		now,
+		u.Pb.GetConfirmedBy(),
+		u.Pb.GetId(),
+		strings.ToLower(purchases.SupplierBankAccountStatus_PENDING.String()),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec confirm supplier bank account: %v", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return status.Errorf(codes.Internal, "Rows affected confirm supplier bank account: %v", err)
+	} else if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "bank account is not waiting for confirmation")
+	}
+
+	if len(u.Pb.GetReplaceId()) > 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM supplier_bank_accounts WHERE id = $1 AND supplier_id = $2`, u.Pb.GetReplaceId(), u.Pb.GetSupplierId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec delete replaced supplier bank account: %v", err)
+		}
+		u.Pb.ReplaceId = ""
+	}
+
+	if u.Pb.GetRemoval() {
+		_, err = tx.ExecContext(ctx, `DELETE FROM supplier_bank_accounts WHERE id = $1`, u.Pb.GetId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec delete supplier bank account removal request: %v", err)
+		}
+	}
+
+	u.Pb.Status = purchases.SupplierBankAccountStatus_ACTIVE
+	u.Pb.ConfirmedAt = now.String()
+
+	return nil
+}
+
+// Delete cancel a pending request, an active account is removed through a confirmed removal request
+func (u *SupplierBankAccount) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM supplier_bank_accounts WHERE id = $1 AND status = $2`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete supplier bank account: %v", err)
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, u.Pb.GetId(), strings.ToLower(purchases.SupplierBankAccountStatus_PENDING.String()))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete supplier bank account: %v", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return status.Errorf(codes.Internal, "Rows affected delete supplier bank account: %v", err)
+	} else if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "bank account is not waiting for confirmation")
+	}
+
+	return nil
+}
+
+func (u *SupplierBankAccount) scan(row interface{ Scan(...interface{}) error }, companyID *string) error {
+	var bankAccountStatus string
+	var replaceID, confirmedBy sql.NullString
+	var requestedAt time.Time
+	var confirmedAt sql.NullTime
+	err := row.Scan(
+		&u.Pb.Id, companyID, &u.Pb.SupplierId, &u.Pb.BankName, &u.Pb.AccountNumber, &u.Pb.AccountName,
+		&bankAccountStatus, &replaceID, &u.Pb.Removal, &requestedAt, &u.Pb.RequestedBy, &confirmedAt, &confirmedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Status = purchases.SupplierBankAccountStatus(purchases.SupplierBankAccountStatus_value[strings.ToUpper(bankAccountStatus)])
+	u.Pb.ReplaceId = replaceID.String
+	u.Pb.RequestedAt = requestedAt.String()
+	u.Pb.ConfirmedBy = confirmedBy.String
+	if confirmedAt.Valid {
+		u.Pb.ConfirmedAt = confirmedAt.Time.String()
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type SupplierContact struct {
+	Pb purchases.SupplierContact
+}
+
+func (u *SupplierContact) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT supplier_contacts.id, suppliers.company_id, supplier_contacts.supplier_id, supplier_contacts.name,
+			supplier_contacts.role, supplier_contacts.email, supplier_contacts.phone,
+			supplier_contacts.created_at, supplier_contacts.created_by, supplier_contacts.updated_at, supplier_contacts.updated_by
+		FROM supplier_contacts
+		JOIN suppliers ON supplier_contacts.supplier_id = suppliers.id
+		WHERE supplier_contacts.id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get supplier contact: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.SupplierId, &u.Pb.Name, &u.Pb.Role, &u.Pb.Email, &u.Pb.Phone,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get supplier contact: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get supplier contact: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.PermissionDenied, "its not your company data")
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+func (u *SupplierContact) List(ctx context.Context, db *sql.DB, supplierID string) ([]*purchases.SupplierContact, error) {
+	var list []*purchases.SupplierContact
+	query := `
+		SELECT id, supplier_id, name, role, email, phone, created_at, created_by, updated_at, updated_by
+		FROM supplier_contacts WHERE supplier_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, supplierID)
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list supplier contact: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pbContact purchases.SupplierContact
+		var createdAt, updatedAt time.Time
+		err = rows.Scan(
+			&pbContact.Id, &pbContact.SupplierId, &pbContact.Name, &pbContact.Role, &pbContact.Email, &pbContact.Phone,
+			&createdAt, &pbContact.CreatedBy, &updatedAt, &pbContact.UpdatedBy,
+		)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbContact.CreatedAt = createdAt.String()
+		pbContact.UpdatedAt = updatedAt.String()
+		list = append(list, &pbContact)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+func (u *SupplierContact) Create(ctx context.Context, db *sql.DB) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO supplier_contacts (id, supplier_id, name, role, email, phone, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert supplier contact: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetSupplierId(),
+		u.Pb.GetName(),
+		u.Pb.GetRole(),
+		u.Pb.GetEmail(),
+		u.Pb.GetPhone(),
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert supplier contact: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	return nil
+}
+
+func (u *SupplierContact) Update(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		UPDATE supplier_contacts SET
+		name = $1,
+		role = $2,
+		email = $3,
+		phone = $4,
+		updated_at = $5,
+		updated_by = $6
+		WHERE id = $7
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare update supplier contact: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetName(),
+		u.Pb.GetRole(),
+		u.Pb.GetEmail(),
+		u.Pb.GetPhone(),
+		now,
+		u.Pb.GetUpdatedBy(),
+		u.Pb.GetId(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update supplier contact: %v", err)
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+func (u *SupplierContact) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM supplier_contacts WHERE id = $1`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete supplier contact: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete supplier contact: %v", err)
+	}
+
+	return nil
+}
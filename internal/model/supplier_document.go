@@ -0,0 +1,307 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupplierDocument is a licence, certificate or contract of supplier. The file itself is kept in blob storage under FileKey.
+type SupplierDocument struct {
+	Pb      purchases.SupplierDocument
+	FileKey string
+}
+
+const supplierDocumentColumns = `supplier_documents.id, suppliers.company_id, supplier_documents.supplier_id,
+	supplier_documents.type, supplier_documents.number, supplier_documents.issued_date, supplier_documents.expiry_date,
+	supplier_documents.mandatory, supplier_documents.file_key, supplier_documents.file_name,
+	supplier_documents.content_type, supplier_documents.file_size,
+	supplier_documents.created_at, supplier_documents.created_by, supplier_documents.updated_at, supplier_documents.updated_by`
+
+func (u *SupplierDocument) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT ` + supplierDocumentColumns + `
+		FROM supplier_documents
+		JOIN suppliers ON supplier_documents.supplier_id = suppliers.id
+		WHERE supplier_documents.id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get supplier document: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	err = u.scan(stmt.QueryRowContext(ctx, u.Pb.GetId()), &companyID)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get supplier document: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get supplier document: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.PermissionDenied, "its not your company data")
+	}
+
+	return nil
+}
+
+func (u *SupplierDocument) List(ctx context.Context, db *sql.DB, supplierID string) ([]*purchases.SupplierDocument, error) {
+	query := `
+		SELECT ` + supplierDocumentColumns + `
+		FROM supplier_documents
+		JOIN suppliers ON supplier_documents.supplier_id = suppliers.id
+		WHERE supplier_documents.supplier_id = $1 AND suppliers.company_id = $2
+		ORDER BY supplier_documents.type, supplier_documents.issued_date
+	`
+
+	return u.list(ctx, db, query, supplierID, ctx.Value(app.Ctx("companyID")).(string))
+}
+
+// ListExpiring list documents of the company already expired or expiring within days from today
+func (u *SupplierDocument) ListExpiring(ctx context.Context, db *sql.DB, days int) ([]*purchases.SupplierDocument, error) {
+	query := `
+		SELECT ` + supplierDocumentColumns + `
+		FROM supplier_documents
+		JOIN suppliers ON supplier_documents.supplier_id = suppliers.id
+		WHERE suppliers.company_id = $1 AND supplier_documents.expiry_date <= CURRENT_DATE + $2::int
+		ORDER BY supplier_documents.expiry_date, suppliers.name
+	`
+
+	return u.list(ctx, db, query, ctx.Value(app.Ctx("companyID")).(string), days)
+}
+
+// ExpiredMandatory return the document numbers of supplier mandatory documents that are already expired
+func (u *SupplierDocument) ExpiredMandatory(ctx context.Context, db *sql.DB, supplierID string) ([]string, error) {
+	var numbers []string
+	query := `
+		SELECT number FROM supplier_documents
+		WHERE supplier_id = $1 AND mandatory AND expiry_date < CURRENT_DATE
+		ORDER BY expiry_date
+	`
+
+	rows, err := db.QueryContext(ctx, query, supplierID)
+	if err != nil {
+		return numbers, status.Errorf(codes.Internal, "Query expired supplier document: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			return numbers, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+		numbers = append(numbers, number)
+	}
+
+	if rows.Err() != nil {
+		return numbers, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return numbers, nil
+}
+
+func (u *SupplierDocument) Create(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = u.Pb.GetCreatedBy()
+
+	issuedDate, expiryDate, err := u.dates()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO supplier_documents (id, supplier_id, type, number, issued_date, expiry_date, mandatory,
+			file_key, file_name, content_type, file_size, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $12, $13)
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert supplier document: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetSupplierId(),
+		strings.ToLower(u.Pb.GetType().String()),
+		u.Pb.GetNumber(),
+		issuedDate,
+		expiryDate,
+		u.Pb.GetMandatory(),
+		u.FileKey,
+		u.Pb.GetFileName(),
+		u.Pb.GetContentType(),
+		u.Pb.GetFileSize(),
+		now,
+		u.Pb.GetCreatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert supplier document: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	return nil
+}
+
+func (u *SupplierDocument) Update(ctx context.Context, db *sql.DB) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	issuedDate, expiryDate, err := u.dates()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE supplier_documents SET
+		type = $1,
+		number = $2,
+		issued_date = $3,
+		expiry_date = $4,
+		mandatory = $5,
+		updated_at = $6,
+		updated_by = $7
+		WHERE id = $8
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare update supplier document: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		strings.ToLower(u.Pb.GetType().String()),
+		u.Pb.GetNumber(),
+		issuedDate,
+		expiryDate,
+		u.Pb.GetMandatory(),
+		now,
+		u.Pb.GetUpdatedBy(),
+		u.Pb.GetId(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update supplier document: %v", err)
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+func (u *SupplierDocument) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM supplier_documents WHERE id = $1`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete supplier document: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete supplier document: %v", err)
+	}
+
+	return nil
+}
+
+// NewFileKey generate id of new document and the key of its file in blob storage
+func (u *SupplierDocument) NewFileKey(companyID string) {
+	u.Pb.Id = uuid.New().String()
+	u.FileKey = companyID + "/supplier-documents/" + u.Pb.GetId()
+}
+
+func (u *SupplierDocument) list(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*purchases.SupplierDocument, error) {
+	var list []*purchases.SupplierDocument
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list supplier document: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var document SupplierDocument
+		var companyID string
+		err = document.scan(rows, &companyID)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		list = append(list, &document.Pb)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+func (u *SupplierDocument) scan(row interface{ Scan(...interface{}) error }, companyID *string) error {
+	var documentType string
+	var issuedDate, createdAt, updatedAt time.Time
+	var expiryDate sql.NullTime
+	err := row.Scan(
+		&u.Pb.Id, companyID, &u.Pb.SupplierId, &documentType, &u.Pb.Number, &issuedDate, &expiryDate,
+		&u.Pb.Mandatory, &u.FileKey, &u.Pb.FileName, &u.Pb.ContentType, &u.Pb.FileSize,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Type = purchases.SupplierDocumentType(purchases.SupplierDocumentType_value[strings.ToUpper(documentType)])
+	u.Pb.IssuedDate = issuedDate.String()
+	u.Pb.ExpiryDate = ""
+	if expiryDate.Valid {
+		u.Pb.ExpiryDate = expiryDate.Time.String()
+	}
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+// dates convert issued and expiry date, the expiry date is optional for document without expiration
+func (u *SupplierDocument) dates() (time.Time, sql.NullTime, error) {
+	var expiryDate sql.NullTime
+
+	issuedDate, err := parseDate(u.Pb.GetIssuedDate())
+	if err != nil {
+		return issuedDate, expiryDate, status.Errorf(codes.Internal, "convert issued date: %v", err)
+	}
+
+	if len(u.Pb.GetExpiryDate()) > 0 {
+		t, err := parseDate(u.Pb.GetExpiryDate())
+		if err != nil {
+			return issuedDate, expiryDate, status.Errorf(codes.Internal, "convert expiry date: %v", err)
+		}
+		expiryDate = sql.NullTime{Time: t, Valid: true}
+	}
+
+	return issuedDate, expiryDate, nil
+}
+
+// parseDate accept the date layout of request or the layout read back by Get, formatted with time.Time.String()
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04:05.000Z", s)
+	if err != nil {
+		return time.Parse("2006-01-02 15:04:05 -0700 MST", s)
+	}
+
+	return t, nil
+}
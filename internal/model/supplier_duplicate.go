@@ -0,0 +1,202 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// minNameSimilarity is the lowest similarity of normalized names to be reported as duplicate
+const minNameSimilarity = 0.85
+
+// legalEntities are dropped from the name before comparing, so "PT. Maju Jaya" equal to "Maju Jaya Tbk"
+var legalEntities = map[string]bool{
+	"pt": true, "cv": true, "ud": true, "pd": true, "fa": true, "tbk": true, "persero": true, "koperasi": true,
+}
+
+// SupplierDuplicate find pairs of suppliers in the company that are likely the same supplier,
+// by normalized name, phone and npwp. When SupplierId is set, only pairs of the supplier are returned.
+type SupplierDuplicate struct {
+	SupplierId string
+}
+
+type duplicateCandidate struct {
+	pb    *purchases.Supplier
+	name  string
+	phone string
+}
+
+func (u *SupplierDuplicate) Find(ctx context.Context, db *sql.DB) ([]*purchases.SupplierDuplicate, error) {
+	var list []*purchases.SupplierDuplicate
+	query := `
+		SELECT id, code, name, address, phone, npwp, status, blocked_reason, created_at, created_by, updated_at, updated_by
+		FROM suppliers WHERE company_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list supplier duplicate: %v", err)
+	}
+	defer rows.Close()
+
+	var candidates []duplicateCandidate
+	for rows.Next() {
+		var pbSupplier purchases.Supplier
+		var supplierStatus string
+		var createdAt, updatedAt time.Time
+		err = rows.Scan(&pbSupplier.Id, &pbSupplier.Code, &pbSupplier.Name, &pbSupplier.Address, &pbSupplier.Phone, &pbSupplier.Npwp,
+			&supplierStatus, &pbSupplier.BlockedReason, &createdAt, &pbSupplier.CreatedBy, &updatedAt, &pbSupplier.UpdatedBy)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbSupplier.Status = SupplierStatusFromString(supplierStatus)
+		pbSupplier.CreatedAt = createdAt.String()
+		pbSupplier.UpdatedAt = updatedAt.String()
+
+		candidates = append(candidates, duplicateCandidate{
+			pb:    &pbSupplier,
+			name:  normalizeSupplierName(pbSupplier.Name),
+			phone: normalizePhone(pbSupplier.Phone),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", err)
+	}
+
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			a, b := candidates[i], candidates[j]
+			if len(u.SupplierId) > 0 && a.pb.Id != u.SupplierId && b.pb.Id != u.SupplierId {
+				continue
+			}
+
+			if len(u.SupplierId) > 0 && b.pb.Id == u.SupplierId {
+				a, b = b, a
+			}
+
+			if duplicate := compareSuppliers(a, b); duplicate != nil {
+				list = append(list, duplicate)
+			}
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+
+	return list, nil
+}
+
+// compareSuppliers return the duplicate pair with score between 0 and 1, or nil when nothing match
+func compareSuppliers(a, b duplicateCandidate) *purchases.SupplierDuplicate {
+	var reasons []string
+	distinct := 1.0
+
+	if len(a.pb.Npwp) > 0 && a.pb.Npwp == b.pb.Npwp {
+		reasons = append(reasons, "npwp")
+		distinct = 0
+	}
+
+	if len(a.phone) > 0 && a.phone == b.phone {
+		reasons = append(reasons, "phone")
+		distinct *= 0.2
+	}
+
+	if similarity := stringSimilarity(a.name, b.name); len(a.name) > 0 && similarity >= minNameSimilarity {
+		reasons = append(reasons, "name")
+		distinct *= 1 - similarity*0.9
+	}
+
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	return &purchases.SupplierDuplicate{
+		Supplier:  a.pb,
+		Duplicate: b.pb,
+		Score:     1 - distinct,
+		Reasons:   reasons,
+	}
+}
+
+// normalizeSupplierName lower the name, strip punctuation and legal entity, "PT. Maju-Jaya Tbk" => "maju jaya"
+func normalizeSupplierName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var words []string
+	for _, field := range fields {
+		if !legalEntities[field] {
+			words = append(words, field)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// normalizePhone keep the digits only and use local prefix, "+62 21-555" => "021555"
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+
+	normalized := digits.String()
+	if strings.HasPrefix(normalized, "62") {
+		normalized = "0" + normalized[2:]
+	}
+
+	// too short to identify a supplier
+	if len(normalized) < 6 {
+		return ""
+	}
+
+	return normalized
+}
+
+// stringSimilarity is 1 minus levenshtein distance relative to the longer string
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
@@ -0,0 +1,213 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupplierMerge move every reference of the duplicate supplier into the surviving supplier,
+// delete the duplicate and keep the merge record as audit trail.
+type SupplierMerge struct {
+	Pb purchases.SupplierMerge
+}
+
+// Merge must be run in single transaction, so the purchases are never left pointing to deleted supplier
+func (u *SupplierMerge) Merge(ctx context.Context, tx *sql.Tx) error {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+
+	// lock both suppliers, so no purchase is created for the duplicate while merging
+	{
+		rows, err := tx.QueryContext(ctx,
+			`SELECT id, code, name FROM suppliers WHERE company_id = $1 AND id IN ($2, $3) FOR UPDATE`,
+			companyID, u.Pb.GetSupplierId(), u.Pb.GetMergedSupplierId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "Query lock suppliers: %v", err)
+		}
+
+		found := 0
+		for rows.Next() {
+			var id, code, name string
+			if err := rows.Scan(&id, &code, &name); err != nil {
+				rows.Close()
+				return status.Errorf(codes.Internal, "scan data: %v", err)
+			}
+			if id == u.Pb.GetMergedSupplierId() {
+				u.Pb.MergedCode = code
+				u.Pb.MergedName = name
+			}
+			found++
+		}
+		rows.Close()
+
+		if found != 2 {
+			return status.Error(codes.NotFound, "supplier not found")
+		}
+	}
+
+	// move the purchases one by one, so each change is recorded in audit log
+	var purchaseIDs []string
+	{
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM purchases WHERE company_id = $1 AND supplier_id = $2 FOR UPDATE`,
+			companyID, u.Pb.GetMergedSupplierId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "Query purchases of merged supplier: %v", err)
+		}
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return status.Errorf(codes.Internal, "scan data: %v", err)
+			}
+			purchaseIDs = append(purchaseIDs, id)
+		}
+		rows.Close()
+	}
+
+	for _, purchaseID := range purchaseIDs {
+		before, err := auditSnapshot(ctx, tx, AuditPurchase, purchaseID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE purchases SET supplier_id = $1, version = version + 1 WHERE id = $2`, u.Pb.GetSupplierId(), purchaseID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec move purchases: %v", err)
+		}
+
+		if err := writeAudit(ctx, tx, AuditPurchase, purchaseID, auditUpdate, before); err != nil {
+			return err
+		}
+	}
+	u.Pb.PurchaseCount = int32(len(purchaseIDs))
+
+	queries := []string{
+		`UPDATE supplier_contacts SET supplier_id = $1 WHERE supplier_id = $2`,
+		`UPDATE supplier_addresses SET supplier_id = $1 WHERE supplier_id = $2`,
+		`UPDATE supplier_documents SET supplier_id = $1 WHERE supplier_id = $2`,
+		// price of the surviving supplier win when both have price list for the same product and date
+		`UPDATE supplier_prices SET supplier_id = $1 WHERE supplier_id = $2 AND NOT EXISTS (
+			SELECT 1 FROM supplier_prices p WHERE p.supplier_id = $1
+				AND p.product_id = supplier_prices.product_id AND p.valid_from = supplier_prices.valid_from
+		)`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, u.Pb.GetSupplierId(), u.Pb.GetMergedSupplierId()); err != nil {
+			return status.Errorf(codes.Internal, "Exec move supplier data: %v", err)
+		}
+	}
+
+	if err := u.mergeAvailability(ctx, tx); err != nil {
+		return err
+	}
+
+	// bank accounts are moved as pending request of the merging user, so another user must confirm them
+	// before they are used for payment of the surviving supplier
+	_, err := tx.ExecContext(ctx, `
+		UPDATE supplier_bank_accounts SET
+		supplier_id = $1,
+		status = $3,
+		requested_at = $4,
+		requested_by = $5,
+		confirmed_at = NULL,
+		confirmed_by = NULL
+		WHERE supplier_id = $2
+	`, u.Pb.GetSupplierId(), u.Pb.GetMergedSupplierId(),
+		strings.ToLower(purchases.SupplierBankAccountStatus_PENDING.String()),
+		time.Now().UTC(), ctx.Value(app.Ctx("userID")).(string))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec move supplier bank accounts: %v", err)
+	}
+
+	mergedSupplier := Supplier{Pb: purchases.Supplier{Id: u.Pb.GetMergedSupplierId()}}
+	if err := mergedSupplier.Delete(ctx, tx); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	u.Pb.Id = uuid.New().String()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO supplier_merges (id, company_id, supplier_id, merged_supplier_id, merged_code, merged_name, purchase_count, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert supplier merge: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		companyID,
+		u.Pb.GetSupplierId(),
+		u.Pb.GetMergedSupplierId(),
+		u.Pb.GetMergedCode(),
+		u.Pb.GetMergedName(),
+		u.Pb.GetPurchaseCount(),
+		now,
+		u.Pb.GetCreatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert supplier merge: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+
+	return nil
+}
+
+// mergeAvailability make the surviving supplier available wherever either supplier was available.
+// A supplier without any branch and region is available for every branch, so it stays without them.
+func (u *SupplierMerge) mergeAvailability(ctx context.Context, tx *sql.Tx) error {
+	restricted := make(map[string]bool, 2)
+	for _, supplierID := range []string{u.Pb.GetSupplierId(), u.Pb.GetMergedSupplierId()} {
+		var isRestricted bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM supplier_branches WHERE supplier_id = $1)
+				OR EXISTS (SELECT 1 FROM supplier_regions WHERE supplier_id = $1)
+		`, supplierID).Scan(&isRestricted)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Query supplier availability: %v", err)
+		}
+		restricted[supplierID] = isRestricted
+	}
+
+	if !restricted[u.Pb.GetSupplierId()] {
+		return nil
+	}
+
+	if !restricted[u.Pb.GetMergedSupplierId()] {
+		for _, table := range []string{"supplier_branches", "supplier_regions"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE supplier_id = $1`, u.Pb.GetSupplierId()); err != nil {
+				return status.Errorf(codes.Internal, "Exec delete %s: %v", table, err)
+			}
+		}
+		return nil
+	}
+
+	queries := []string{
+		`INSERT INTO supplier_branches (supplier_id, branch_id)
+			SELECT $1, branch_id FROM supplier_branches WHERE supplier_id = $2
+			ON CONFLICT DO NOTHING`,
+		`INSERT INTO supplier_regions (supplier_id, region_id)
+			SELECT $1, region_id FROM supplier_regions WHERE supplier_id = $2
+			ON CONFLICT DO NOTHING`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, u.Pb.GetSupplierId(), u.Pb.GetMergedSupplierId()); err != nil {
+			return status.Errorf(codes.Internal, "Exec merge supplier availability: %v", err)
+		}
+	}
+
+	return nil
+}
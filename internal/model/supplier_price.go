@@ -0,0 +1,145 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupplierPrice is the agreed price of a product from a supplier, effective since ValidFrom
+type SupplierPrice struct {
+	Pb purchases.SupplierPrice
+}
+
+func (u *SupplierPrice) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT supplier_prices.id, suppliers.company_id, supplier_prices.supplier_id, supplier_prices.product_id,
+			supplier_prices.price, supplier_prices.valid_from, supplier_prices.created_at, supplier_prices.created_by
+		FROM supplier_prices
+		JOIN suppliers ON supplier_prices.supplier_id = suppliers.id
+		WHERE supplier_prices.id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get supplier price: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	var validFrom, createdAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.SupplierId, &u.Pb.ProductId, &u.Pb.Price, &validFrom, &createdAt, &u.Pb.CreatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get supplier price: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get supplier price: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.PermissionDenied, "its not your company data")
+	}
+
+	u.Pb.ValidFrom = validFrom.String()
+	u.Pb.CreatedAt = createdAt.String()
+
+	return nil
+}
+
+func (u *SupplierPrice) List(ctx context.Context, db *sql.DB, supplierID string) ([]*purchases.SupplierPrice, error) {
+	var list []*purchases.SupplierPrice
+	query := `
+		SELECT id, supplier_id, product_id, price, valid_from, created_at, created_by
+		FROM supplier_prices WHERE supplier_id = $1
+		ORDER BY product_id, valid_from DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, supplierID)
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query list supplier price: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pbPrice purchases.SupplierPrice
+		var validFrom, createdAt time.Time
+		err = rows.Scan(&pbPrice.Id, &pbPrice.SupplierId, &pbPrice.ProductId, &pbPrice.Price, &validFrom, &createdAt, &pbPrice.CreatedBy)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbPrice.ValidFrom = validFrom.String()
+		pbPrice.CreatedAt = createdAt.String()
+		list = append(list, &pbPrice)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return list, nil
+}
+
+func (u *SupplierPrice) Create(ctx context.Context, db *sql.DB) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	validFrom, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetValidFrom())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert valid from: %v", err)
+	}
+
+	query := `
+		INSERT INTO supplier_prices (id, supplier_id, product_id, price, valid_from, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (supplier_id, product_id, valid_from) DO UPDATE SET price = EXCLUDED.price
+		RETURNING id
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert supplier price: %v", err)
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRowContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetSupplierId(),
+		u.Pb.GetProductId(),
+		u.Pb.GetPrice(),
+		validFrom,
+		now,
+		u.Pb.GetCreatedBy(),
+	).Scan(&u.Pb.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert supplier price: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+
+	return nil
+}
+
+func (u *SupplierPrice) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM supplier_prices WHERE id = $1`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete supplier price: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete supplier price: %v", err)
+	}
+
+	return nil
+}
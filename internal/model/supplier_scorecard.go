@@ -0,0 +1,331 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupplierScorecard calculate supplier performance of purchases dated between DateFrom and DateTo.
+// All rates are percentages. Score is weighted from on-time delivery (40%), fill rate (40%)
+// and the complement of return rate (20%).
+type SupplierScorecard struct {
+	Receive    Receive
+	SupplierId string
+	DateFrom   time.Time
+	DateTo     time.Time
+}
+
+// maxScorecardPurchases limit the purchases of a scorecard, each of them is looked up on inventory service
+const maxScorecardPurchases = 5000
+
+// scorecardReceiveConcurrency is the number of concurrent calls to inventory service
+const scorecardReceiveConcurrency = 8
+
+type scorecardDelivery struct {
+	expected    int
+	onTime      int
+	orderedQty  int64
+	receivedQty int64
+}
+
+func (u *SupplierScorecard) Calculate(ctx context.Context, db *sql.DB) ([]*purchases.SupplierScorecard, error) {
+	var list []*purchases.SupplierScorecard
+
+	query := `
+		WITH p AS (
+			SELECT id, supplier_id, total_price FROM purchases
+			WHERE company_id = $1 AND purchase_date BETWEEN $2 AND $3 %s
+		),
+		t AS (
+			SELECT supplier_id, COUNT(*) purchase_count, SUM(total_price) total_price FROM p GROUP BY supplier_id
+		),
+		d AS (
+			SELECT p.supplier_id, SUM(purchase_details.quantity) quantity,
+				SUM(CASE WHEN price_list.price IS NULL THEN 0 ELSE (purchase_details.price - price_list.price) * purchase_details.quantity END) variance_amount,
+				SUM(CASE WHEN price_list.price IS NULL THEN 0 ELSE price_list.price * purchase_details.quantity END) list_amount
+			FROM p
+			JOIN purchases ON p.id = purchases.id
+			JOIN purchase_details ON p.id = purchase_details.purchase_id
+			LEFT JOIN LATERAL (
+				SELECT supplier_prices.price FROM supplier_prices
+				WHERE supplier_prices.supplier_id = p.supplier_id
+					AND supplier_prices.product_id = purchase_details.product_id
+					AND supplier_prices.valid_from <= purchases.purchase_date
+				ORDER BY supplier_prices.valid_from DESC
+				LIMIT 1
+			) price_list ON true
+			GROUP BY p.supplier_id
+		),
+		r AS (
+			SELECT p.supplier_id, SUM(purchase_return_details.quantity) quantity
+			FROM p
+			JOIN purchase_returns ON p.id = purchase_returns.purchase_id
+			JOIN purchase_return_details ON purchase_returns.id = purchase_return_details.purchase_return_id
+			GROUP BY p.supplier_id
+		),
+		rt AS (
+			SELECT p.supplier_id, SUM(purchase_returns.total_price) total_price
+			FROM p
+			JOIN purchase_returns ON p.id = purchase_returns.purchase_id
+			GROUP BY p.supplier_id
+		)
+		SELECT suppliers.id, suppliers.code, suppliers.name, t.purchase_count,
+			t.total_price - COALESCE(rt.total_price, 0),
+			COALESCE(d.quantity, 0), COALESCE(r.quantity, 0),
+			COALESCE(d.variance_amount, 0), COALESCE(d.list_amount, 0)
+		FROM t
+		JOIN suppliers ON t.supplier_id = suppliers.id
+		LEFT JOIN d ON t.supplier_id = d.supplier_id
+		LEFT JOIN r ON t.supplier_id = r.supplier_id
+		LEFT JOIN rt ON t.supplier_id = rt.supplier_id
+	`
+
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.DateFrom, u.DateTo}
+	supplierFilter := ""
+	if len(u.SupplierId) > 0 {
+		paramQueries = append(paramQueries, u.SupplierId)
+		supplierFilter = fmt.Sprintf("AND supplier_id = $%d", len(paramQueries))
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(query, supplierFilter), paramQueries...)
+	if err != nil {
+		return list, status.Errorf(codes.Internal, "Query supplier scorecard: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pbSupplier purchases.Supplier
+		var purchaseCount int32
+		var totalSpend, varianceAmount, listAmount float64
+		var orderedQty, returnedQty int64
+		err = rows.Scan(&pbSupplier.Id, &pbSupplier.Code, &pbSupplier.Name, &purchaseCount, &totalSpend,
+			&orderedQty, &returnedQty, &varianceAmount, &listAmount)
+		if err != nil {
+			return list, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		scorecard := &purchases.SupplierScorecard{
+			Supplier:      &pbSupplier,
+			DateFrom:      u.DateFrom.String(),
+			DateTo:        u.DateTo.String(),
+			PurchaseCount: purchaseCount,
+			TotalSpend:    totalSpend,
+			ReturnRate:    percentage(float64(returnedQty), float64(orderedQty)),
+			PriceVariance: percentage(varianceAmount, listAmount),
+		}
+		list = append(list, scorecard)
+	}
+
+	if rows.Err() != nil {
+		return list, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	deliveries, err := u.deliveries(ctx, db)
+	if err != nil {
+		return list, err
+	}
+
+	for _, scorecard := range list {
+		if delivery, ok := deliveries[scorecard.GetSupplier().GetId()]; ok {
+			scorecard.OnTimeDeliveryRate = percentage(float64(delivery.onTime), float64(delivery.expected))
+			scorecard.FillRate = percentage(float64(delivery.receivedQty), float64(delivery.orderedQty))
+		}
+
+		scorecard.Score = 0.4*scorecard.GetOnTimeDeliveryRate() + 0.4*scorecard.GetFillRate() + 0.2*(100-scorecard.GetReturnRate())
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].GetScore() > list[j].GetScore()
+	})
+
+	for i, scorecard := range list {
+		scorecard.Rank = int32(i + 1)
+	}
+
+	return list, nil
+}
+
+// deliveries compare every purchase of the period with its receiving transactions on inventory service
+func (u *SupplierScorecard) deliveries(ctx context.Context, db *sql.DB) (map[string]*scorecardDelivery, error) {
+	deliveries := make(map[string]*scorecardDelivery)
+
+	query := `
+		SELECT purchases.id, purchases.supplier_id, purchases.expected_date, purchase_details.product_id, purchase_details.quantity
+		FROM purchases
+		JOIN purchase_details ON purchases.id = purchase_details.purchase_id
+		WHERE purchases.company_id = $1 AND purchases.purchase_date BETWEEN $2 AND $3
+	`
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.DateFrom, u.DateTo}
+	if len(u.SupplierId) > 0 {
+		paramQueries = append(paramQueries, u.SupplierId)
+		query += fmt.Sprintf(" AND purchases.supplier_id = $%d", len(paramQueries))
+	}
+
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return deliveries, status.Errorf(codes.Internal, "Query supplier deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	type purchaseLines struct {
+		supplierID   string
+		expectedDate sql.NullTime
+		quantities   map[string]int64
+	}
+	var purchaseIds []string
+	purchaseMap := make(map[string]*purchaseLines)
+	for rows.Next() {
+		var purchaseID, supplierID, productID string
+		var expectedDate sql.NullTime
+		var quantity int64
+		err = rows.Scan(&purchaseID, &supplierID, &expectedDate, &productID, &quantity)
+		if err != nil {
+			return deliveries, status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		if _, ok := purchaseMap[purchaseID]; !ok {
+			purchaseIds = append(purchaseIds, purchaseID)
+			purchaseMap[purchaseID] = &purchaseLines{supplierID: supplierID, expectedDate: expectedDate, quantities: make(map[string]int64)}
+		}
+		purchaseMap[purchaseID].quantities[productID] += quantity
+	}
+
+	if rows.Err() != nil {
+		return deliveries, status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	if len(purchaseIds) > maxScorecardPurchases {
+		return deliveries, status.Errorf(codes.InvalidArgument, "Please supply shorter period, the scorecard is limited to %d purchases", maxScorecardPurchases)
+	}
+
+	receiveMap, err := u.receives(ctx, purchaseIds)
+	if err != nil {
+		return deliveries, err
+	}
+
+	now := time.Now().UTC()
+	for _, purchaseID := range purchaseIds {
+		purchase := purchaseMap[purchaseID]
+		delivery, ok := deliveries[purchase.supplierID]
+		if !ok {
+			delivery = &scorecardDelivery{}
+			deliveries[purchase.supplierID] = delivery
+		}
+
+		receives := receiveMap[purchaseID]
+		received := make(map[string]int64)
+		var firstReceive time.Time
+		for _, receive := range receives {
+			if receiveDate, err := time.Parse("2006-01-02", firstN(receive.GetReceiveDate(), 10)); err == nil {
+				if firstReceive.IsZero() || receiveDate.Before(firstReceive) {
+					firstReceive = receiveDate
+				}
+			}
+
+			for _, detail := range receive.GetDetails() {
+				received[detail.GetProductId()] += int64(detail.GetQuantity())
+			}
+		}
+
+		for productID, quantity := range purchase.quantities {
+			delivery.orderedQty += quantity
+			if received[productID] > quantity {
+				delivery.receivedQty += quantity
+			} else {
+				delivery.receivedQty += received[productID]
+			}
+		}
+
+		if !purchase.expectedDate.Valid {
+			continue
+		}
+
+		// a purchase not received yet is late once its expected date has passed, and not counted before
+		if !firstReceive.IsZero() {
+			delivery.expected++
+			if !firstReceive.After(purchase.expectedDate.Time) {
+				delivery.onTime++
+			}
+		} else if purchase.expectedDate.Time.Before(now) {
+			delivery.expected++
+		}
+	}
+
+	return deliveries, nil
+}
+
+// receives list the receiving transactions of purchases on inventory service, at most
+// scorecardReceiveConcurrency calls run at once. The first error cancel the remaining calls.
+func (u *SupplierScorecard) receives(ctx context.Context, purchaseIds []string) (map[string][]*inventories.Receive, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	receives := make(map[string][]*inventories.Receive, len(purchaseIds))
+	sem := make(chan struct{}, scorecardReceiveConcurrency)
+
+	for _, purchaseID := range purchaseIds {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(purchaseID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			list, err := u.Receive.ListByPurchase(ctx, purchaseID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			receives[purchaseID] = list
+		}(purchaseID)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return receives, firstErr
+	}
+
+	return receives, app.ContextError(ctx)
+}
+
+func percentage(value, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return value / total * 100
+}
+
+func firstN(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/cache"
+)
+
+const (
+	defaultUserCacheTTL  = time.Minute
+	defaultUserCacheSize = 10000
+)
+
+// userCache keep the responses of user service: users, regions, branches and branch list of company.
+// The keys are prefixed by company, so a company never read the entries loaded for another company.
+// The cached values are shared, they must not be modified. A change on user service is seen after the TTL
+// at the latest, or at once when the Invalidate function of the changed data is called.
+var userCache = cache.New(defaultUserCacheTTL, defaultUserCacheSize)
+
+func init() {
+	expvar.Publish("user_cache", expvar.Func(func() interface{} { return userCache.Stats() }))
+}
+
+// SetUserCache replace the cache of user service, ttl or size less than or equal zero disable the cache
+func SetUserCache(ttl time.Duration, size int) {
+	userCache = cache.New(ttl, size)
+}
+
+// UserCacheStats return hit rate of the cache of user service
+func UserCacheStats() cache.Stats {
+	return userCache.Stats()
+}
+
+// GetUserLogin return the user of the context from the cache or user service
+func GetUserLogin(ctx context.Context, userClient users.UserServiceClient) (*users.User, error) {
+	return getUserLogin(ctx, userClient)
+}
+
+// InvalidateUser must be called when the user, its group or its branch assignment is changed
+func InvalidateUser(companyID string, userID string) {
+	userCache.Delete(userCacheKey(companyID, "user", userID))
+}
+
+// InvalidateRegion must be called when the region or the branches of region is changed
+func InvalidateRegion(companyID string, regionID string) {
+	userCache.Delete(userCacheKey(companyID, "region", regionID))
+}
+
+// InvalidateBranch must be called when the branch is created, changed or deleted.
+// Regions of the company are dropped as well, because they contain the branch.
+func InvalidateBranch(companyID string, branchID string) {
+	userCache.Delete(userCacheKey(companyID, "branch", branchID))
+	userCache.Delete(userCacheKey(companyID, "branches", ""))
+	userCache.DeletePrefix(userCacheKey(companyID, "region", ""))
+}
+
+// InvalidateUserCache drop everything cached from user service
+func InvalidateUserCache() {
+	userCache.Flush()
+}
+
+// userCacheKey return the key of the entry of company, an empty id is the prefix of every entry of the kind
+func userCacheKey(companyID string, kind string, id string) string {
+	return companyID + ":" + kind + ":" + id
+}
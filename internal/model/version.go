@@ -0,0 +1,25 @@
+package model
+
+import (
+	"database/sql"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrVersionConflict is returned when the row has been changed by another user since it was read
+var ErrVersionConflict = status.Error(codes.Aborted, "data has been changed by another user, please reload and try again")
+
+// checkVersion check the update guarded by version matched a row
+func checkVersion(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "Rows affected: %v", err)
+	}
+
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+// Package pdf write simple PDF documents with text, lines, rectangles and images.
+// Only the standard Helvetica fonts are used, so no font file is embedded.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register jpeg decoder for logo
+	_ "image/png"  // register png decoder for logo
+	"io"
+	"strings"
+)
+
+// Paper size in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Document is a PDF being written, the origin of coordinates is the top left corner of the page
+type Document struct {
+	Width  float64
+	Height float64
+
+	pages   []*bytes.Buffer
+	current int
+	images  []*pdfImage
+}
+
+type pdfImage struct {
+	width, height int
+	filter        string
+	colorSpace    string
+	data          []byte
+}
+
+// Image is an image added to the document, it can be drawn many times
+type Image struct {
+	index  int
+	Width  int
+	Height int
+}
+
+// New create document with the page size in points
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+// AddPage start new page, the next drawing is written into it
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.current = len(d.pages) - 1
+}
+
+// SetPage make the next drawing written into page n, the first page is 1.
+// It is used to draw what is known after all pages are added, ex: "page 1 of 3".
+func (d *Document) SetPage(n int) {
+	if n >= 1 && n <= len(d.pages) {
+		d.current = n - 1
+	}
+}
+
+// PageCount return the number of pages
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	return d.pages[d.current]
+}
+
+// Text write s with its baseline at y
+func (d *Document) Text(x, y float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+
+	fmt.Fprintf(d.page(), "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, num(size), num(x), num(d.Height-y), escape(s))
+}
+
+// TextRight write s ending at x
+func (d *Document) TextRight(x, y float64, size float64, bold bool, s string) {
+	d.Text(x-StringWidth(s, bold, size), y, size, bold, s)
+}
+
+// TextCenter write s centered at x
+func (d *Document) TextCenter(x, y float64, size float64, bold bool, s string) {
+	d.Text(x-StringWidth(s, bold, size)/2, y, size, bold, s)
+}
+
+// Line draw line with the width in points
+func (d *Document) Line(x1, y1, x2, y2 float64, width float64) {
+	fmt.Fprintf(d.page(), "%s w %s %s m %s %s l S\n", num(width), num(x1), num(d.Height-y1), num(x2), num(d.Height-y2))
+}
+
+// Rect fill rectangle with gray level, 0 is black and 1 is white
+func (d *Document) Rect(x, y, width, height float64, gray float64) {
+	fmt.Fprintf(d.page(), "q %s g %s %s %s %s re f Q\n", num(gray), num(x), num(d.Height-y-height), num(width), num(height))
+}
+
+// AddImage decode jpeg or png image. RGB or gray jpeg is embedded as is, other image is embedded as compressed RGB.
+func (d *Document) AddImage(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read image: %v", err)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %v", err)
+	}
+
+	bounds := img.Bounds()
+	embedded := &pdfImage{width: bounds.Dx(), height: bounds.Dy(), colorSpace: "DeviceRGB"}
+
+	switch img.(type) {
+	case *image.YCbCr, *image.Gray:
+		if format != "jpeg" {
+			break
+		}
+		if _, ok := img.(*image.Gray); ok {
+			embedded.colorSpace = "DeviceGray"
+		}
+		embedded.filter = "DCTDecode"
+		embedded.data = data
+	}
+
+	if embedded.data == nil {
+		// flatten transparency on white background
+		var raw bytes.Buffer
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, a := img.At(x, y).RGBA()
+				white := 0xffff - a
+				raw.WriteByte(byte((r + white) >> 8))
+				raw.WriteByte(byte((g + white) >> 8))
+				raw.WriteByte(byte((b + white) >> 8))
+			}
+		}
+
+		embedded.filter = "FlateDecode"
+		embedded.data, err = deflate(raw.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.images = append(d.images, embedded)
+	return &Image{index: len(d.images), Width: embedded.width, Height: embedded.height}, nil
+}
+
+// DrawImage draw the image into the box with its top left corner at x, y
+func (d *Document) DrawImage(img *Image, x, y, width, height float64) {
+	fmt.Fprintf(d.page(), "q %s 0 0 %s %s %s cm /Im%d Do Q\n", num(width), num(height), num(x), num(d.Height-y-height), img.index)
+}
+
+// WriteTo write the PDF file
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	// object numbers: 1 catalog, 2 pages, 3-4 fonts, then images, then page and content of each page
+	firstImage := 5
+	firstPage := firstImage + len(d.images)
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)), nil)
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+
+	var xObjects strings.Builder
+	for i, img := range d.images {
+		object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s /Length %d >>",
+			img.width, img.height, img.colorSpace, img.filter, len(img.data)), img.data)
+		fmt.Fprintf(&xObjects, " /Im%d %d 0 R", i+1, firstImage+i)
+	}
+
+	for i, page := range d.pages {
+		content, err := deflate(page.Bytes())
+		if err != nil {
+			return 0, err
+		}
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+			num(d.Width), num(d.Height), xObjects.String(), firstPage+i*2+1), nil)
+		object(fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>", len(content)), content)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.WriteTo(w)
+}
+
+// Bytes return the PDF file
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("compress: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("compress: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encode convert s into WinAnsi bytes, character outside Latin-1 is replaced by question mark
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 32 && r <= 126, r >= 160 && r <= 255:
+			b = append(b, byte(r))
+		case r == '\t':
+			b = append(b, ' ')
+		default:
+			b = append(b, '?')
+		}
+	}
+
+	return b
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range encode(s) {
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c > 126 {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-0" {
+		return "0"
+	}
+
+	return s
+}
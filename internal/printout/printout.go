@@ -0,0 +1,387 @@
+// Package printout lay out the printed form of purchase documents into PDF.
+package printout
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jacky-htg/purchase-service/internal/pdf"
+)
+
+// Template is the company customization of the printed document
+type Template struct {
+	CompanyName    string
+	CompanyAddress string
+	Terms          string
+	Footer         string
+	// Logo is jpeg or png image, it is skipped when empty
+	Logo []byte
+}
+
+// Field is a label and value printed in the document header
+type Field struct {
+	Label string
+	Value string
+}
+
+// Line is a row of the product table
+type Line struct {
+	ProductCode string
+	ProductName string
+	Unit        string
+	Quantity    int32
+	Price       float64
+	DiscAmount  float64
+	TotalPrice  float64
+}
+
+// Document is the content of printed purchase or purchase return
+type Document struct {
+	Title string
+	// Fields is printed at the right side of the header, ex: number and date
+	Fields []Field
+
+	PartyLabel   string
+	PartyName    string
+	PartyAddress string
+	PartyPhone   string
+	PartyNpwp    string
+
+	BranchName    string
+	BranchAddress string
+	BranchPhone   string
+
+	Lines []Line
+
+	Price                    float64
+	AdditionalDiscPercentage float32
+	AdditionalDiscAmount     float64
+	TotalPrice               float64
+	Remark                   string
+}
+
+const (
+	margin     = 40.0
+	fontSize   = 9.0
+	lineHeight = 12.0
+	rowHeight  = 16.0
+	footerY    = pdf.A4Height - 30
+	contentEnd = pdf.A4Height - 60
+)
+
+type column struct {
+	title string
+	width float64
+	right bool
+}
+
+var columns = []column{
+	{"No", 22, true},
+	{"Code", 62, false},
+	{"Product", 155, false},
+	{"Qty", 40, true},
+	{"Unit", 38, false},
+	{"Price", 70, true},
+	{"Disc", 62, true},
+	{"Total", 66.28, true},
+}
+
+type renderer struct {
+	doc *pdf.Document
+	tpl Template
+	in  Document
+	y   float64
+}
+
+// Render write the document in A4 portrait. The product table continue on next pages when it does not fit.
+func Render(tpl Template, in Document) ([]byte, error) {
+	r := &renderer{doc: pdf.New(pdf.A4Width, pdf.A4Height), tpl: tpl, in: in}
+
+	var logo *pdf.Image
+	if len(tpl.Logo) > 0 {
+		var err error
+		logo, err = r.doc.AddImage(bytes.NewReader(tpl.Logo))
+		if err != nil {
+			return nil, fmt.Errorf("logo: %v", err)
+		}
+	}
+
+	r.doc.AddPage()
+	r.header(logo)
+	r.parties()
+	r.tableHeader()
+
+	for i, line := range in.Lines {
+		if r.y+rowHeight > contentEnd {
+			r.doc.AddPage()
+			r.y = margin
+			r.doc.Text(margin, r.y+fontSize, fontSize, true, in.Title+" "+fieldValue(in.Fields, 0)+" (continued)")
+			r.y += lineHeight * 1.5
+			r.tableHeader()
+		}
+		r.row(i+1, line)
+	}
+
+	r.doc.Line(margin, r.y, pdf.A4Width-margin, r.y, 0.5)
+	r.y += 4
+	r.summary()
+	r.terms()
+
+	for page := 1; page <= r.doc.PageCount(); page++ {
+		r.footer(page)
+	}
+
+	return r.doc.Bytes()
+}
+
+func (r *renderer) header(logo *pdf.Image) {
+	x := margin
+	top := margin
+
+	if logo != nil && logo.Width > 0 && logo.Height > 0 {
+		// fit the logo into 120x50 points box
+		scale := math.Min(120/float64(logo.Width), 50/float64(logo.Height))
+		width, height := float64(logo.Width)*scale, float64(logo.Height)*scale
+		r.doc.DrawImage(logo, margin, top, width, height)
+		x += width + 10
+	}
+
+	y := top + 12
+	if len(r.tpl.CompanyName) > 0 {
+		r.doc.Text(x, y, 13, true, r.tpl.CompanyName)
+		y += 14
+	}
+	for _, line := range r.wrap(r.tpl.CompanyAddress, 230, false, fontSize) {
+		r.doc.Text(x, y, fontSize, false, line)
+		y += lineHeight
+	}
+
+	right := pdf.A4Width - margin
+	r.doc.TextRight(right, top+14, 16, true, r.in.Title)
+	fy := top + 32
+	for _, field := range r.in.Fields {
+		r.doc.TextRight(right-90, fy, fontSize, false, field.Label)
+		r.doc.TextRight(right, fy, fontSize, true, field.Value)
+		fy += lineHeight
+	}
+
+	r.y = math.Max(math.Max(y, fy), top+56) + 6
+	r.doc.Line(margin, r.y, right, r.y, 1)
+	r.y += 14
+}
+
+func (r *renderer) parties() {
+	half := (pdf.A4Width - margin*2) / 2
+
+	left := r.block(margin, half-10, r.in.PartyLabel, r.in.PartyName,
+		r.in.PartyAddress, labeled("Phone", r.in.PartyPhone), labeled("NPWP", r.in.PartyNpwp))
+	right := r.block(margin+half, half, "Branch", r.in.BranchName, r.in.BranchAddress, labeled("Phone", r.in.BranchPhone))
+
+	r.y = math.Max(left, right) + 10
+}
+
+// block write titled paragraph and return the y after it
+func (r *renderer) block(x, width float64, title, name string, lines ...string) float64 {
+	y := r.y
+	r.doc.Text(x, y, fontSize-1, false, strings.ToUpper(title))
+	y += lineHeight
+	r.doc.Text(x, y, fontSize+1, true, name)
+	y += lineHeight
+	for _, text := range lines {
+		for _, line := range r.wrap(text, width, false, fontSize) {
+			r.doc.Text(x, y, fontSize, false, line)
+			y += lineHeight
+		}
+	}
+
+	return y
+}
+
+func (r *renderer) tableHeader() {
+	r.doc.Rect(margin, r.y, pdf.A4Width-margin*2, rowHeight, 0.9)
+	r.cells(r.y, true, func(i int) string { return columns[i].title })
+	r.y += rowHeight
+}
+
+func (r *renderer) row(no int, line Line) {
+	values := []string{
+		fmt.Sprint(no),
+		line.ProductCode,
+		line.ProductName,
+		fmt.Sprint(line.Quantity),
+		line.Unit,
+		FormatAmount(line.Price),
+		discount(0, line.DiscAmount),
+		FormatAmount(line.TotalPrice),
+	}
+	r.cells(r.y, false, func(i int) string { return values[i] })
+	r.y += rowHeight
+	r.doc.Line(margin, r.y, pdf.A4Width-margin, r.y, 0.2)
+}
+
+func (r *renderer) cells(y float64, bold bool, value func(i int) string) {
+	x := margin
+	baseline := y + rowHeight - 5
+	for i, col := range columns {
+		text := r.truncate(value(i), col.width-6, bold, fontSize)
+		if col.right {
+			r.doc.TextRight(x+col.width-3, baseline, fontSize, bold, text)
+		} else {
+			r.doc.Text(x+3, baseline, fontSize, bold, text)
+		}
+		x += col.width
+	}
+}
+
+func (r *renderer) summary() {
+	rows := []Field{{"Subtotal", FormatAmount(r.in.Price)}}
+	if r.in.AdditionalDiscAmount > 0 {
+		rows = append(rows, Field{"Additional Disc", discount(r.in.AdditionalDiscPercentage, r.in.AdditionalDiscAmount)})
+	}
+	rows = append(rows, Field{"Total", FormatAmount(r.in.TotalPrice)})
+
+	if r.y+float64(len(rows))*rowHeight > contentEnd {
+		r.doc.AddPage()
+		r.y = margin
+	}
+
+	right := pdf.A4Width - margin
+	for i, row := range rows {
+		bold := i == len(rows)-1
+		r.doc.TextRight(right-100, r.y+12, fontSize, bold, row.Label)
+		r.doc.TextRight(right-3, r.y+12, fontSize, bold, row.Value)
+		r.y += rowHeight
+	}
+	r.y += 10
+}
+
+func (r *renderer) terms() {
+	sections := []Field{{"Remark", r.in.Remark}, {"Terms and Conditions", r.tpl.Terms}}
+	width := pdf.A4Width - margin*2
+
+	for _, section := range sections {
+		if len(strings.TrimSpace(section.Value)) == 0 {
+			continue
+		}
+
+		lines := r.wrap(section.Value, width, false, fontSize)
+		if r.y+lineHeight*2 > contentEnd {
+			r.doc.AddPage()
+			r.y = margin
+		}
+
+		r.doc.Text(margin, r.y+fontSize, fontSize, true, section.Label)
+		r.y += lineHeight + 2
+		for _, line := range lines {
+			if r.y+lineHeight > contentEnd {
+				r.doc.AddPage()
+				r.y = margin
+			}
+			r.doc.Text(margin, r.y+fontSize, fontSize, false, line)
+			r.y += lineHeight
+		}
+		r.y += 8
+	}
+}
+
+func (r *renderer) footer(page int) {
+	r.doc.SetPage(page)
+	r.doc.Line(margin, footerY-12, pdf.A4Width-margin, footerY-12, 0.3)
+	if len(r.tpl.Footer) > 0 {
+		r.doc.Text(margin, footerY, fontSize-1, false, r.truncate(r.tpl.Footer, 420, false, fontSize-1))
+	}
+	r.doc.TextRight(pdf.A4Width-margin, footerY, fontSize-1, false, fmt.Sprintf("Page %d of %d", page, r.doc.PageCount()))
+}
+
+// wrap split text into lines fitting the width, it keep the line breaks of the text
+func (r *renderer) wrap(text string, width float64, bold bool, size float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			continue
+		}
+
+		current := ""
+		for _, word := range words {
+			next := word
+			if len(current) > 0 {
+				next = current + " " + word
+			}
+			if len(current) > 0 && pdf.StringWidth(next, bold, size) > width {
+				lines = append(lines, current)
+				next = word
+			}
+			current = r.truncate(next, width, bold, size)
+		}
+		lines = append(lines, current)
+	}
+
+	return lines
+}
+
+// truncate cut text which is wider than width and end it with dots
+func (r *renderer) truncate(text string, width float64, bold bool, size float64) string {
+	if pdf.StringWidth(text, bold, size) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.StringWidth(string(runes)+"...", bold, size) > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "..."
+}
+
+// FormatAmount write amount with thousand separator and 2 decimals, ex: 1,250,000.00
+func FormatAmount(amount float64) string {
+	s := fmt.Sprintf("%.2f", math.Abs(amount))
+	integer, decimal := s[:len(s)-3], s[len(s)-3:]
+
+	var b strings.Builder
+	if amount < 0 && s != "0.00" {
+		b.WriteByte('-')
+	}
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteString(decimal)
+
+	return b.String()
+}
+
+func discount(percentage float32, amount float64) string {
+	if amount == 0 {
+		return "-"
+	}
+	if percentage > 0 {
+		return fmt.Sprintf("%s (%g%%)", FormatAmount(amount), percentage)
+	}
+
+	return FormatAmount(amount)
+}
+
+func labeled(label, value string) string {
+	if len(value) == 0 {
+		return ""
+	}
+
+	return label + ": " + value
+}
+
+func fieldValue(fields []Field, i int) string {
+	if i < len(fields) {
+		return fields[i].Value
+	}
+
+	return ""
+}
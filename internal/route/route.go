@@ -7,12 +7,14 @@ import (
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/mail"
 	"github.com/jacky-htg/purchase-service/internal/service"
+	"github.com/jacky-htg/purchase-service/internal/storage"
 	"google.golang.org/grpc"
 )
 
 // GrpcRoute func
-func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *grpc.ClientConn, inventoryConn *grpc.ClientConn) {
+func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *grpc.ClientConn, inventoryConn *grpc.ClientConn, blob storage.Storage, mailer *mail.Mailer) {
 	purchaseServer := service.Purchase{
 		Db:            db,
 		UserClient:    users.NewUserServiceClient((userConn)),
@@ -20,6 +22,8 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *g
 		BranchClient:  users.NewBranchServiceClient(userConn),
 		ProductClient: inventories.NewProductServiceClient(inventoryConn),
 		ReceiveClient: inventories.NewReceiveServiceClient(inventoryConn),
+		Storage:       blob,
+		Mailer:        mailer,
 	}
 	purchases.RegisterPurchaseServiceServer(grpcServer, &purchaseServer)
 
@@ -29,11 +33,28 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *g
 		RegionClient:  users.NewRegionServiceClient(userConn),
 		BranchClient:  users.NewBranchServiceClient(userConn),
 		ReceiveClient: inventories.NewReceiveServiceClient(inventoryConn),
+		Storage:       blob,
 	}
 	purchases.RegisterPurchaseReturnServiceServer(grpcServer, &purchaseReturnServer)
 
 	supplierServer := service.Supplier{
-		Db: db,
+		Db:            db,
+		UserClient:    users.NewUserServiceClient(userConn),
+		RegionClient:  users.NewRegionServiceClient(userConn),
+		BranchClient:  users.NewBranchServiceClient(userConn),
+		ReceiveClient: inventories.NewReceiveServiceClient(inventoryConn),
+		Storage:       blob,
 	}
 	purchases.RegisterSupplierServiceServer(grpcServer, &supplierServer)
+
+	reportServer := service.Report{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+	}
+	purchases.RegisterReportServiceServer(grpcServer, &reportServer)
+
+	auditServer := service.Audit{Db: db}
+	purchases.RegisterAuditServiceServer(grpcServer, &auditServer)
 }
@@ -109,6 +109,444 @@ var migrations = []darwin.Migration{
 			CONSTRAINT fk_purchase_return_details_to_purchase_returns FOREIGN KEY (purchase_return_id) REFERENCES purchase_returns(id) ON DELETE CASCADE ON UPDATE CASCADE
 		);`,
 	},
+	{
+		Version:     6,
+		Description: "Add Supplier Status",
+		Script: `
+		ALTER TABLE suppliers
+			ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'blocked')),
+			ADD COLUMN blocked_reason VARCHAR(255) NOT NULL DEFAULT '';`,
+	},
+	{
+		Version:     7,
+		Description: "Add Supplier Tax Registration",
+		Script: `
+		ALTER TABLE suppliers ADD COLUMN npwp VARCHAR(16) NOT NULL DEFAULT '';`,
+	},
+	{
+		Version:     8,
+		Description: "Add Supplier Contacts",
+		Script: `
+		CREATE TABLE supplier_contacts (
+			id uuid NOT NULL PRIMARY KEY,
+			supplier_id uuid NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			role VARCHAR(45) NOT NULL,
+			email VARCHAR(100) NOT NULL,
+			phone VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL,
+			CONSTRAINT fk_supplier_contacts_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);`,
+	},
+	{
+		Version:     9,
+		Description: "Add Supplier Addresses",
+		Script: `
+		CREATE TABLE supplier_addresses (
+			id uuid NOT NULL PRIMARY KEY,
+			supplier_id uuid NOT NULL,
+			type VARCHAR(10) NOT NULL CHECK (type IN ('billing', 'pickup')),
+			address VARCHAR(255) NOT NULL,
+			city VARCHAR(100) NOT NULL,
+			postal_code VARCHAR(10) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL,
+			CONSTRAINT fk_supplier_addresses_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);`,
+	},
+	{
+		Version:     10,
+		Description: "Add Supplier Bank Accounts",
+		Script: `
+		CREATE TABLE supplier_bank_accounts (
+			id uuid NOT NULL PRIMARY KEY,
+			supplier_id uuid NOT NULL,
+			bank_name VARCHAR(100) NOT NULL,
+			account_number VARCHAR(45) NOT NULL,
+			account_name VARCHAR(100) NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active')),
+			replace_id uuid,
+			requested_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			requested_by uuid NOT NULL,
+			confirmed_at TIMESTAMP,
+			confirmed_by uuid,
+			CONSTRAINT fk_supplier_bank_accounts_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			CONSTRAINT fk_supplier_bank_accounts_to_replaced FOREIGN KEY (replace_id) REFERENCES supplier_bank_accounts(id) ON DELETE SET NULL
+		);`,
+	},
+	{
+		Version:     11,
+		Description: "Add Purchase Expected Date",
+		Script: `
+		ALTER TABLE purchases ADD COLUMN expected_date DATE;`,
+	},
+	{
+		Version:     12,
+		Description: "Add Supplier Prices",
+		Script: `
+		CREATE TABLE supplier_prices (
+			id uuid NOT NULL PRIMARY KEY,
+			supplier_id uuid NOT NULL,
+			product_id uuid NOT NULL,
+			price DOUBLE PRECISION NOT NULL CHECK (price > 0),
+			valid_from DATE NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			UNIQUE(supplier_id, product_id, valid_from),
+			CONSTRAINT fk_supplier_prices_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);`,
+	},
+	{
+		Version:     13,
+		Description: "Add Supplier Merges",
+		Script: `
+		CREATE TABLE supplier_merges (
+			id uuid NOT NULL PRIMARY KEY,
+			company_id uuid NOT NULL,
+			supplier_id uuid NOT NULL,
+			merged_supplier_id uuid NOT NULL,
+			merged_code CHAR(10) NOT NULL,
+			merged_name VARCHAR(45) NOT NULL,
+			purchase_count INT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL
+		);
+		CREATE INDEX supplier_merges_supplier_id_idx ON supplier_merges (supplier_id);`,
+	},
+	{
+		Version:     14,
+		Description: "Add Supplier Documents",
+		Script: `
+		CREATE TABLE supplier_documents (
+			id uuid NOT NULL PRIMARY KEY,
+			supplier_id uuid NOT NULL,
+			type VARCHAR(20) NOT NULL CHECK (type IN ('business_licence', 'halal_certificate', 'contract', 'other')),
+			number VARCHAR(100) NOT NULL,
+			issued_date DATE NOT NULL,
+			expiry_date DATE,
+			mandatory BOOLEAN NOT NULL DEFAULT FALSE,
+			file_key VARCHAR(255) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			content_type VARCHAR(100) NOT NULL,
+			file_size BIGINT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL,
+			CONSTRAINT fk_supplier_documents_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);
+		CREATE INDEX supplier_documents_expiry_date_idx ON supplier_documents (expiry_date);`,
+	},
+	{
+		Version:     15,
+		Description: "Add Purchase Settings",
+		Script: `
+		CREATE TABLE purchase_settings (
+			company_id uuid NOT NULL PRIMARY KEY,
+			block_expired_document BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL
+		);`,
+	},
+	{
+		Version:     16,
+		Description: "Add Supplier Branches and Regions",
+		Script: `
+		CREATE TABLE supplier_branches (
+			supplier_id uuid NOT NULL,
+			branch_id uuid NOT NULL,
+			PRIMARY KEY (supplier_id, branch_id),
+			CONSTRAINT fk_supplier_branches_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);
+		CREATE TABLE supplier_regions (
+			supplier_id uuid NOT NULL,
+			region_id uuid NOT NULL,
+			PRIMARY KEY (supplier_id, region_id),
+			CONSTRAINT fk_supplier_regions_to_suppliers FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);`,
+	},
+	{
+		Version:     17,
+		Description: "Add Audit Logs",
+		Script: `
+		CREATE TABLE audit_logs (
+			id uuid NOT NULL PRIMARY KEY,
+			company_id uuid NOT NULL,
+			entity VARCHAR(50) NOT NULL,
+			entity_id uuid NOT NULL,
+			action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+			actor uuid NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			before JSONB,
+			after JSONB
+		);
+		CREATE INDEX audit_logs_entity_idx ON audit_logs (company_id, entity, entity_id, created_at);
+		CREATE RULE audit_logs_no_update AS ON UPDATE TO audit_logs DO INSTEAD NOTHING;
+		CREATE RULE audit_logs_no_delete AS ON DELETE TO audit_logs DO INSTEAD NOTHING;`,
+	},
+	{
+		Version:     18,
+		Description: "Add Version for Optimistic Concurrency",
+		Script: `
+		ALTER TABLE purchases ADD COLUMN version INT NOT NULL DEFAULT 1;
+		ALTER TABLE purchase_returns ADD COLUMN version INT NOT NULL DEFAULT 1;
+		ALTER TABLE suppliers ADD COLUMN version INT NOT NULL DEFAULT 1;`,
+	},
+	{
+		Version:     19,
+		Description: "Create Table idempotency_keys",
+		Script: `
+		CREATE TABLE idempotency_keys (
+			company_id uuid NOT NULL,
+			key VARCHAR(255) NOT NULL,
+			method VARCHAR(255) NOT NULL,
+			request_hash CHAR(64) NOT NULL,
+			response_type VARCHAR(255),
+			response BYTEA,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (company_id, key)
+		);
+		CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);`,
+	},
+	{
+		Version:     20,
+		Description: "Enable Row Level Security by Company",
+		Script: `
+		ALTER TABLE suppliers ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE suppliers FORCE ROW LEVEL SECURITY;
+		CREATE POLICY suppliers_tenant ON suppliers USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		ALTER TABLE purchases ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE purchases FORCE ROW LEVEL SECURITY;
+		CREATE POLICY purchases_tenant ON purchases USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		ALTER TABLE purchase_returns ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE purchase_returns FORCE ROW LEVEL SECURITY;
+		CREATE POLICY purchase_returns_tenant ON purchase_returns USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		ALTER TABLE supplier_merges ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_merges FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_merges_tenant ON supplier_merges USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		ALTER TABLE purchase_settings ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE purchase_settings FORCE ROW LEVEL SECURITY;
+		CREATE POLICY purchase_settings_tenant ON purchase_settings USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		ALTER TABLE audit_logs ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE audit_logs FORCE ROW LEVEL SECURITY;
+		CREATE POLICY audit_logs_tenant ON audit_logs USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		ALTER TABLE purchase_details ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE purchase_details FORCE ROW LEVEL SECURITY;
+		CREATE POLICY purchase_details_tenant ON purchase_details USING (EXISTS (SELECT 1 FROM purchases WHERE purchases.id = purchase_details.purchase_id));
+		ALTER TABLE purchase_return_details ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE purchase_return_details FORCE ROW LEVEL SECURITY;
+		CREATE POLICY purchase_return_details_tenant ON purchase_return_details USING (EXISTS (SELECT 1 FROM purchase_returns WHERE purchase_returns.id = purchase_return_details.purchase_return_id));
+		ALTER TABLE supplier_contacts ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_contacts FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_contacts_tenant ON supplier_contacts USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_contacts.supplier_id));
+		ALTER TABLE supplier_addresses ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_addresses FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_addresses_tenant ON supplier_addresses USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_addresses.supplier_id));
+		ALTER TABLE supplier_bank_accounts ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_bank_accounts FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_bank_accounts_tenant ON supplier_bank_accounts USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_bank_accounts.supplier_id));
+		ALTER TABLE supplier_prices ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_prices FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_prices_tenant ON supplier_prices USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_prices.supplier_id));
+		ALTER TABLE supplier_documents ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_documents FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_documents_tenant ON supplier_documents USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_documents.supplier_id));
+		ALTER TABLE supplier_branches ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_branches FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_branches_tenant ON supplier_branches USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_branches.supplier_id));
+		ALTER TABLE supplier_regions ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE supplier_regions FORCE ROW LEVEL SECURITY;
+		CREATE POLICY supplier_regions_tenant ON supplier_regions USING (EXISTS (SELECT 1 FROM suppliers WHERE suppliers.id = supplier_regions.supplier_id));`,
+	},
+	{
+		Version:     21,
+		Description: "Add Product Snapshot to Details",
+		Script: `
+		ALTER TABLE purchase_details
+			ADD COLUMN product_code VARCHAR(50) NOT NULL DEFAULT '',
+			ADD COLUMN product_name VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN product_unit VARCHAR(20) NOT NULL DEFAULT '';
+		ALTER TABLE purchase_return_details
+			ADD COLUMN product_code VARCHAR(50) NOT NULL DEFAULT '',
+			ADD COLUMN product_name VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN product_unit VARCHAR(20) NOT NULL DEFAULT '';`,
+	},
+	{
+		Version:     22,
+		Description: "Add Document Templates",
+		Script: `
+		CREATE TABLE document_templates (
+			company_id uuid NOT NULL,
+			document_type VARCHAR(20) NOT NULL,
+			company_name VARCHAR(255) NOT NULL DEFAULT '',
+			company_address TEXT NOT NULL DEFAULT '',
+			terms TEXT NOT NULL DEFAULT '',
+			footer VARCHAR(500) NOT NULL DEFAULT '',
+			logo_key VARCHAR(255) NOT NULL DEFAULT '',
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL,
+			PRIMARY KEY (company_id, document_type)
+		);
+		ALTER TABLE document_templates ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE document_templates FORCE ROW LEVEL SECURITY;
+		CREATE POLICY document_templates_tenant ON document_templates USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);`,
+	},
+	{
+		Version:     23,
+		Description: "Add Purchase Emails",
+		Script: `
+		ALTER TABLE purchases ADD COLUMN email_status VARCHAR(10) NOT NULL DEFAULT 'not_sent';
+		ALTER TABLE document_templates
+			ADD COLUMN email_subject VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN email_body TEXT NOT NULL DEFAULT '';
+		CREATE TABLE purchase_emails (
+			id uuid NOT NULL PRIMARY KEY,
+			purchase_id uuid NOT NULL,
+			recipients TEXT[] NOT NULL,
+			cc TEXT[] NOT NULL DEFAULT '{}',
+			subject VARCHAR(255) NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			resend_of uuid NULL,
+			file_key VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			sent_at TIMESTAMP NULL,
+			CONSTRAINT fk_purchase_emails_to_purchases FOREIGN KEY (purchase_id) REFERENCES purchases(id),
+			CONSTRAINT fk_purchase_emails_to_purchase_emails FOREIGN KEY (resend_of) REFERENCES purchase_emails(id)
+		);
+		CREATE INDEX purchase_emails_purchase_id_idx ON purchase_emails (purchase_id, created_at);
+		ALTER TABLE purchase_emails ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE purchase_emails FORCE ROW LEVEL SECURITY;
+		CREATE POLICY purchase_emails_tenant ON purchase_emails USING (EXISTS (SELECT 1 FROM purchases WHERE purchases.id = purchase_emails.purchase_id));`,
+	},
+	{
+		Version:     24,
+		Description: "Add Spend Report Indexes",
+		Script: `
+		CREATE INDEX purchases_company_id_purchase_date_idx ON purchases (company_id, purchase_date);
+		CREATE INDEX purchase_returns_company_id_return_date_idx ON purchase_returns (company_id, return_date);`,
+	},
+	{
+		Version:     25,
+		Description: "Add Price Variance Threshold",
+		Script: `
+		ALTER TABLE purchase_settings ADD COLUMN price_variance_threshold NUMERIC(7,2) NOT NULL DEFAULT 10;
+		CREATE INDEX purchase_details_product_id_idx ON purchase_details (product_id);`,
+	},
+	{
+		Version:     26,
+		Description: "Add Purchase and Return Listing Indexes",
+		Script: `
+		CREATE INDEX purchases_company_id_created_at_idx ON purchases (company_id, created_at);
+		CREATE INDEX purchases_company_id_total_price_idx ON purchases (company_id, total_price);
+		CREATE INDEX purchases_company_id_created_by_idx ON purchases (company_id, created_by);
+		CREATE INDEX purchases_company_id_email_status_idx ON purchases (company_id, email_status);
+		CREATE INDEX purchase_returns_company_id_created_at_idx ON purchase_returns (company_id, created_at);
+		CREATE INDEX purchase_returns_company_id_total_price_idx ON purchase_returns (company_id, total_price);
+		CREATE INDEX purchase_returns_company_id_created_by_idx ON purchase_returns (company_id, created_by);
+		CREATE INDEX purchase_returns_purchase_id_idx ON purchase_returns (purchase_id);
+		CREATE INDEX purchase_return_details_product_id_idx ON purchase_return_details (product_id);`,
+	},
+	{
+		Version:     27,
+		Description: "Add Full Text Search",
+		Script: `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		ALTER TABLE suppliers ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', code), 'A') || setweight(to_tsvector('simple', name), 'A')
+				|| setweight(to_tsvector('simple', address), 'C')
+		) STORED;
+		ALTER TABLE purchases ADD COLUMN search_vector tsvector NOT NULL DEFAULT ''::tsvector;
+		CREATE FUNCTION purchase_search_vector(p_id uuid, p_code text, p_remark text, p_supplier_id uuid) RETURNS tsvector AS $$
+			SELECT setweight(to_tsvector('simple', p_code), 'A')
+				|| setweight(to_tsvector('simple', COALESCE((SELECT code || ' ' || name FROM suppliers WHERE id = p_supplier_id), '')), 'B')
+				|| setweight(to_tsvector('simple', COALESCE((SELECT string_agg(product_code || ' ' || product_name, ' ') FROM purchase_details WHERE purchase_id = p_id), '')), 'C')
+				|| setweight(to_tsvector('simple', p_remark), 'D')
+		$$ LANGUAGE SQL STABLE;
+		CREATE FUNCTION purchases_search_trigger() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector := purchase_search_vector(NEW.id, NEW.code, NEW.remark, NEW.supplier_id);
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER purchases_search BEFORE INSERT OR UPDATE OF code, remark, supplier_id ON purchases
+			FOR EACH ROW EXECUTE FUNCTION purchases_search_trigger();
+		CREATE FUNCTION purchase_details_search_trigger() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP <> 'DELETE' THEN
+				UPDATE purchases SET search_vector = purchase_search_vector(id, code, remark, supplier_id) WHERE id = NEW.purchase_id;
+			END IF;
+			IF TG_OP <> 'INSERT' THEN
+				UPDATE purchases SET search_vector = purchase_search_vector(id, code, remark, supplier_id) WHERE id = OLD.purchase_id;
+			END IF;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER purchase_details_search AFTER INSERT OR UPDATE OF purchase_id, product_code, product_name OR DELETE ON purchase_details
+			FOR EACH ROW EXECUTE FUNCTION purchase_details_search_trigger();
+		CREATE FUNCTION suppliers_search_trigger() RETURNS trigger AS $$
+		BEGIN
+			UPDATE purchases SET search_vector = purchase_search_vector(id, code, remark, supplier_id) WHERE supplier_id = NEW.id;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER suppliers_search AFTER UPDATE OF code, name ON suppliers
+			FOR EACH ROW EXECUTE FUNCTION suppliers_search_trigger();
+		ALTER TABLE purchases NO FORCE ROW LEVEL SECURITY;
+		ALTER TABLE suppliers NO FORCE ROW LEVEL SECURITY;
+		UPDATE purchases SET search_vector = purchase_search_vector(id, code, remark, supplier_id);
+		ALTER TABLE purchases FORCE ROW LEVEL SECURITY;
+		ALTER TABLE suppliers FORCE ROW LEVEL SECURITY;
+		CREATE INDEX purchases_search_vector_idx ON purchases USING GIN (search_vector);
+		CREATE INDEX suppliers_search_vector_idx ON suppliers USING GIN (search_vector);
+		CREATE INDEX purchases_code_trgm_idx ON purchases USING GIN ((code::text) gin_trgm_ops);
+		CREATE INDEX purchase_returns_code_trgm_idx ON purchase_returns USING GIN ((code::text) gin_trgm_ops);
+		CREATE INDEX purchase_returns_remark_trgm_idx ON purchase_returns USING GIN (remark gin_trgm_ops);
+		CREATE INDEX suppliers_code_trgm_idx ON suppliers USING GIN ((code::text) gin_trgm_ops);
+		CREATE INDEX suppliers_phone_trgm_idx ON suppliers USING GIN (phone gin_trgm_ops);
+		CREATE INDEX suppliers_npwp_trgm_idx ON suppliers USING GIN (npwp gin_trgm_ops);`,
+	},
+	{
+		Version:     28,
+		Description: "Add Idempotency Key Lease",
+		Script: `
+		ALTER TABLE idempotency_keys ADD COLUMN locked_at TIMESTAMP NOT NULL DEFAULT NOW();`,
+	},
+	{
+		Version:     29,
+		Description: "Add Supplier Bank Account Removal Request",
+		Script: `
+		ALTER TABLE supplier_bank_accounts ADD COLUMN removal BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE supplier_bank_accounts NO FORCE ROW LEVEL SECURITY;
+		DELETE FROM supplier_bank_accounts older USING supplier_bank_accounts newer
+			WHERE older.status = 'pending' AND newer.status = 'pending' AND older.replace_id = newer.replace_id
+			AND (older.requested_at, older.id) < (newer.requested_at, newer.id);
+		ALTER TABLE supplier_bank_accounts FORCE ROW LEVEL SECURITY;
+		CREATE UNIQUE INDEX supplier_bank_accounts_pending_replace_idx ON supplier_bank_accounts (replace_id) WHERE status = 'pending';`,
+	},
+	{
+		Version:     30,
+		Description: "Scope Supplier Name Unique By Company",
+		Script: `
+		ALTER TABLE suppliers DROP CONSTRAINT suppliers_name_key;
+		ALTER TABLE suppliers ADD CONSTRAINT suppliers_company_id_name_key UNIQUE (company_id, name);`,
+	},
+	{
+		Version:     31,
+		Description: "Enable Row Level Security on Idempotency Keys",
+		Script: `
+		ALTER TABLE idempotency_keys ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE idempotency_keys FORCE ROW LEVEL SECURITY;
+		CREATE POLICY idempotency_keys_tenant ON idempotency_keys USING (company_id = NULLIF(current_setting('app.company_id', true), '')::uuid);
+		CREATE POLICY idempotency_keys_bypass ON idempotency_keys USING (current_setting('app.bypass_rls', true) = 'on');`,
+	},
 }
 
 func Migrate(db *sql.DB) error {
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"database/sql"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// auditEntities is the entities recorded in audit log
+var auditEntities = map[string]bool{
+	model.AuditSupplier:             true,
+	model.AuditPurchase:             true,
+	model.AuditPurchaseDetail:       true,
+	model.AuditPurchaseReturn:       true,
+	model.AuditPurchaseReturnDetail: true,
+}
+
+type Audit struct {
+	Db *sql.DB
+	purchases.UnimplementedAuditServiceServer
+}
+
+func (u *Audit) AuditLogList(in *purchases.AuditLogRequest, stream purchases.AuditService_AuditLogListServer) error {
+	ctx := stream.Context()
+
+	if !auditEntities[in.GetEntity()] {
+		return status.Error(codes.InvalidArgument, "Please supply valid entity")
+	}
+
+	if len(in.GetEntityId()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid entity id")
+	}
+
+	var auditLogModel model.AuditLog
+	list, err := auditLogModel.List(ctx, u.Db, in.GetEntity(), in.GetEntityId())
+	if err != nil {
+		return err
+	}
+
+	for _, auditLog := range list {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(auditLog)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"image"
+	_ "image/jpeg" // register jpeg decoder for logo validation
+	_ "image/png"  // register png decoder for logo validation
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/printout"
+	"github.com/jacky-htg/purchase-service/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxLogoSize limit the size of logo of document template
+const maxLogoSize = 1 << 20
+
+func (u *Purchase) DocumentTemplateView(ctx context.Context, in *purchases.DocumentTemplateRequest) (*purchases.DocumentTemplate, error) {
+	var templateModel model.DocumentTemplate
+	templateModel.Pb.DocumentType = in.GetDocumentType()
+	if err := templateModel.Get(ctx, u.Db); err != nil {
+		return &templateModel.Pb, err
+	}
+
+	if len(templateModel.LogoKey) > 0 {
+		logo, err := readBlob(ctx, u.Storage, templateModel.LogoKey)
+		if err != nil {
+			return &templateModel.Pb, err
+		}
+		templateModel.Pb.Logo = logo
+	}
+
+	return &templateModel.Pb, nil
+}
+
+func (u *Purchase) DocumentTemplateUpdate(ctx context.Context, in *purchases.DocumentTemplate) (*purchases.DocumentTemplate, error) {
+	var templateModel model.DocumentTemplate
+	templateModel.Pb.DocumentType = in.GetDocumentType()
+	if _, ok := purchases.DocumentType_name[int32(in.GetDocumentType())]; !ok {
+		return &templateModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid document type")
+	}
+
+	if len(in.GetLogo()) > maxLogoSize {
+		return &templateModel.Pb, status.Error(codes.InvalidArgument, "logo size exceeds 1 MB")
+	}
+
+	if len(in.GetLogo()) > 0 {
+		if _, format, err := image.DecodeConfig(bytes.NewReader(in.GetLogo())); err != nil || (format != "jpeg" && format != "png") {
+			return &templateModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid logo, only jpeg and png are supported")
+		}
+	}
+
+	for _, text := range []string{in.GetEmailSubject(), in.GetEmailBody()} {
+		if _, err := executeEmailTemplate(text, "", emailData{}); err != nil {
+			return &templateModel.Pb, status.Errorf(codes.InvalidArgument, "Please supply valid email template: %v", err)
+		}
+	}
+
+	if err := templateModel.Get(ctx, u.Db); err != nil {
+		return &templateModel.Pb, err
+	}
+	oldLogoKey := templateModel.LogoKey
+
+	templateModel.Pb.CompanyName = in.GetCompanyName()
+	templateModel.Pb.CompanyAddress = in.GetCompanyAddress()
+	templateModel.Pb.Terms = in.GetTerms()
+	templateModel.Pb.Footer = in.GetFooter()
+	templateModel.Pb.EmailSubject = in.GetEmailSubject()
+	templateModel.Pb.EmailBody = in.GetEmailBody()
+
+	if len(in.GetLogo()) > 0 {
+		templateModel.NewLogoKey(ctx.Value(app.Ctx("companyID")).(string))
+		if _, err := u.Storage.Put(ctx, templateModel.LogoKey, bytes.NewReader(in.GetLogo())); err != nil {
+			return &templateModel.Pb, status.Errorf(codes.Internal, "store logo: %v", err)
+		}
+	} else if in.GetRemoveLogo() {
+		templateModel.LogoKey = ""
+	}
+
+	if err := templateModel.Save(ctx, u.Db); err != nil {
+		return &templateModel.Pb, err
+	}
+
+	if len(oldLogoKey) > 0 && len(templateModel.LogoKey) == 0 {
+		if err := u.Storage.Delete(ctx, oldLogoKey); err != nil && err != storage.ErrNotFound {
+			return &templateModel.Pb, status.Errorf(codes.Internal, "delete logo: %v", err)
+		}
+	}
+
+	templateModel.Pb.Logo = in.GetLogo()
+
+	return &templateModel.Pb, nil
+}
+
+func (u *Purchase) PurchasePdf(ctx context.Context, in *purchases.PdfRequest) (*purchases.PdfDocument, error) {
+	var output purchases.PdfDocument
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	purchaseModel, doc, err := u.purchaseDocument(ctx, in.GetId())
+	if err != nil {
+		return &output, err
+	}
+
+	templateModel, err := documentTemplate(ctx, u.Db, purchases.DocumentType_PURCHASE_ORDER)
+	if err != nil {
+		return &output, err
+	}
+
+	return renderPdf(ctx, u.Storage, templateModel, purchaseModel.Pb.GetId(), purchaseModel.Pb.GetCode(),
+		purchaseModel.Pb.GetVersion(), in.GetArchive(), doc)
+}
+
+// purchaseDocument get the purchase of your branch and its printed content
+func (u *Purchase) purchaseDocument(ctx context.Context, id string) (*model.Purchase, printout.Document, error) {
+	var purchaseModel model.Purchase
+	var doc printout.Document
+
+	purchaseModel.Pb.Id = id
+	if err := purchaseModel.Get(ctx, u.Db); err != nil {
+		return &purchaseModel, doc, err
+	}
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+		Id:           purchaseModel.Pb.GetBranchId(),
+	}
+	if err := mBranch.IsYourBranch(ctx); err != nil {
+		return &purchaseModel, doc, err
+	}
+
+	doc = printout.Document{
+		Title: "PURCHASE ORDER",
+		Fields: []printout.Field{
+			{Label: "Number", Value: purchaseModel.Pb.GetCode()},
+			{Label: "Date", Value: printDate(purchaseModel.Pb.GetPurchaseDate())},
+		},
+		PartyLabel:               "Supplier",
+		Price:                    purchaseModel.Pb.GetPrice(),
+		AdditionalDiscPercentage: purchaseModel.Pb.GetAdditionalDiscPercentage(),
+		AdditionalDiscAmount:     purchaseModel.Pb.GetAdditionalDiscAmount(),
+		TotalPrice:               purchaseModel.Pb.GetTotalPrice(),
+		Remark:                   purchaseModel.Pb.GetRemark(),
+	}
+	if len(purchaseModel.Pb.GetExpectedDate()) > 0 {
+		doc.Fields = append(doc.Fields, printout.Field{Label: "Expected Date", Value: printDate(purchaseModel.Pb.GetExpectedDate())})
+	}
+
+	for _, detail := range purchaseModel.Pb.GetDetails() {
+		doc.Lines = append(doc.Lines, printout.Line{
+			ProductCode: detail.GetProductCode(),
+			ProductName: detail.GetProductName(),
+			Unit:        detail.GetProductUnit(),
+			Quantity:    detail.GetQuantity(),
+			Price:       detail.GetPrice(),
+			DiscAmount:  detail.GetDiscAmount(),
+			TotalPrice:  detail.GetTotalPrice(),
+		})
+	}
+
+	err := documentParties(ctx, u.Db, &mBranch, purchaseModel.Pb.GetSupplier().GetId(), &doc)
+
+	return &purchaseModel, doc, err
+}
+
+func (u *PurchaseReturn) PurchaseReturnPdf(ctx context.Context, in *purchases.PdfRequest) (*purchases.PdfDocument, error) {
+	var output purchases.PdfDocument
+	var purchaseReturnModel model.PurchaseReturn
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	purchaseReturnModel.Pb.Id = in.GetId()
+
+	if err := purchaseReturnModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+		Id:           purchaseReturnModel.Pb.GetBranchId(),
+	}
+	if err := mBranch.IsYourBranch(ctx); err != nil {
+		return &output, err
+	}
+
+	var purchaseModel model.Purchase
+	purchaseModel.Pb.Id = purchaseReturnModel.Pb.GetPurchase().GetId()
+	if err := purchaseModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	doc := printout.Document{
+		Title: "PURCHASE RETURN",
+		Fields: []printout.Field{
+			{Label: "Number", Value: purchaseReturnModel.Pb.GetCode()},
+			{Label: "Date", Value: printDate(purchaseReturnModel.Pb.GetReturnDate())},
+			{Label: "Purchase", Value: purchaseModel.Pb.GetCode()},
+		},
+		PartyLabel:               "Supplier",
+		Price:                    purchaseReturnModel.Pb.GetPrice(),
+		AdditionalDiscPercentage: purchaseReturnModel.Pb.GetAdditionalDiscPercentage(),
+		AdditionalDiscAmount:     purchaseReturnModel.Pb.GetAdditionalDiscAmount(),
+		TotalPrice:               purchaseReturnModel.Pb.GetTotalPrice(),
+		Remark:                   purchaseReturnModel.Pb.GetRemark(),
+	}
+
+	for _, detail := range purchaseReturnModel.Pb.GetDetails() {
+		doc.Lines = append(doc.Lines, printout.Line{
+			ProductCode: detail.GetProductCode(),
+			ProductName: detail.GetProductName(),
+			Unit:        detail.GetProductUnit(),
+			Quantity:    detail.GetQuantity(),
+			Price:       detail.GetPrice(),
+			DiscAmount:  detail.GetDiscAmount(),
+			TotalPrice:  detail.GetTotalPrice(),
+		})
+	}
+
+	err := documentParties(ctx, u.Db, &mBranch, purchaseModel.Pb.GetSupplier().GetId(), &doc)
+	if err != nil {
+		return &output, err
+	}
+
+	templateModel, err := documentTemplate(ctx, u.Db, purchases.DocumentType_PURCHASE_RETURN)
+	if err != nil {
+		return &output, err
+	}
+
+	return renderPdf(ctx, u.Storage, templateModel, purchaseReturnModel.Pb.GetId(), purchaseReturnModel.Pb.GetCode(),
+		purchaseReturnModel.Pb.GetVersion(), in.GetArchive(), doc)
+}
+
+// documentParties fill the supplier and branch of printed document. Billing address of supplier is preferred to its main address.
+func documentParties(ctx context.Context, db *sql.DB, mBranch *model.Branch, supplierID string, doc *printout.Document) error {
+	if err := mBranch.Get(ctx); err != nil {
+		return err
+	}
+
+	doc.BranchName = mBranch.Pb.GetName()
+	doc.BranchAddress = joinAddress(mBranch.Pb.GetAddress(), mBranch.Pb.GetCity(), mBranch.Pb.GetProvince())
+	doc.BranchPhone = mBranch.Pb.GetPhone()
+
+	var supplierModel model.Supplier
+	supplierModel.Pb.Id = supplierID
+	if err := supplierModel.Get(ctx, db); err != nil {
+		return err
+	}
+
+	doc.PartyName = supplierModel.Pb.GetName()
+	doc.PartyAddress = supplierModel.Pb.GetAddress()
+	doc.PartyPhone = supplierModel.Pb.GetPhone()
+	doc.PartyNpwp = supplierModel.Pb.GetNpwp()
+
+	var addressModel model.SupplierAddress
+	addresses, err := addressModel.List(ctx, db, supplierID)
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		if address.GetType() == purchases.SupplierAddressType_BILLING {
+			doc.PartyAddress = joinAddress(address.GetAddress(), address.GetCity(), address.GetPostalCode())
+			break
+		}
+	}
+
+	return nil
+}
+
+func documentTemplate(ctx context.Context, db *sql.DB, documentType purchases.DocumentType) (*model.DocumentTemplate, error) {
+	var templateModel model.DocumentTemplate
+	templateModel.Pb.DocumentType = documentType
+	err := templateModel.Get(ctx, db)
+
+	return &templateModel, err
+}
+
+// renderPdf print the document with the template of the company and archive it when it is requested
+func renderPdf(ctx context.Context, blob storage.Storage, templateModel *model.DocumentTemplate,
+	id string, code string, version int32, archive bool, doc printout.Document) (*purchases.PdfDocument, error) {
+	var output purchases.PdfDocument
+	documentType := templateModel.Pb.GetDocumentType()
+
+	tpl := printout.Template{
+		CompanyName:    templateModel.Pb.GetCompanyName(),
+		CompanyAddress: templateModel.Pb.GetCompanyAddress(),
+		Terms:          templateModel.Pb.GetTerms(),
+		Footer:         templateModel.Pb.GetFooter(),
+	}
+
+	if len(templateModel.LogoKey) > 0 {
+		logo, err := readBlob(ctx, blob, templateModel.LogoKey)
+		if err != nil {
+			return &output, err
+		}
+		tpl.Logo = logo
+	}
+
+	// the details are aggregated without order, print them sorted so the same document always look the same
+	sort.SliceStable(doc.Lines, func(i, j int) bool {
+		return doc.Lines[i].ProductCode < doc.Lines[j].ProductCode
+	})
+
+	content, err := printout.Render(tpl, doc)
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "render pdf: %v", err)
+	}
+
+	output.FileName = strings.ToLower(strings.ReplaceAll(documentType.String(), "_", "-")) + "-" + fileNameSafe(code) + ".pdf"
+	output.Content = content
+
+	if archive {
+		output.FileKey = model.ArchiveKey(ctx.Value(app.Ctx("companyID")).(string), documentType, id, version)
+		if _, err := blob.Put(ctx, output.FileKey, bytes.NewReader(content)); err != nil {
+			return &output, status.Errorf(codes.Internal, "archive pdf: %v", err)
+		}
+	}
+
+	return &output, nil
+}
+
+func readBlob(ctx context.Context, blob storage.Storage, key string) ([]byte, error) {
+	file, err := blob.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "file %s is not found", key)
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "open file: %v", err)
+	}
+	defer file.Close()
+
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "read file: %v", err)
+	}
+
+	return b, nil
+}
+
+// printDate format the date stored by the model for printing, the date is returned as is when it can not be parsed
+func printDate(date string) string {
+	t, err := time.Parse("2006-01-02 15:04:05 -0700 MST", date)
+	if err != nil {
+		return date
+	}
+
+	return t.Format("02 Jan 2006")
+}
+
+func joinAddress(parts ...string) string {
+	var list []string
+	for _, part := range parts {
+		if len(strings.TrimSpace(part)) > 0 {
+			list = append(list, strings.TrimSpace(part))
+		}
+	}
+
+	return strings.Join(list, ", ")
+}
+
+func fileNameSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, s)
+}
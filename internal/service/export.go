@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/sheet"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ExportOptions choose the file format, the columns and the locale of number and date of exported file
+type ExportOptions struct {
+	Format sheet.Format
+	// Columns is the column names in file order, empty means all columns
+	Columns []string
+	// Locale is language tag, ex: id-ID, empty means plain numbers and ISO date
+	Locale string
+}
+
+// exportColumn is a column of exported file, value return the typed value written by sheet.ValueWriter
+type exportColumn[T any] struct {
+	name  string
+	value func(T) interface{}
+}
+
+// exporter write the header and the rows of chosen columns
+type exporter[T any] struct {
+	writer  *sheet.ValueWriter
+	columns []exportColumn[T]
+}
+
+func newExporter[T any](w io.Writer, available []exportColumn[T], options ExportOptions) (*exporter[T], error) {
+	columns := available
+	if len(options.Columns) > 0 {
+		byName := make(map[string]exportColumn[T])
+		for _, column := range available {
+			byName[column.name] = column
+		}
+
+		columns = nil
+		for _, name := range options.Columns {
+			column, ok := byName[name]
+			if !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "Please supply valid column %s", name)
+			}
+			columns = append(columns, column)
+		}
+	}
+
+	locale, err := sheet.ParseLocale(options.Locale)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Please supply valid locale: %v", err)
+	}
+
+	writer, err := sheet.NewValueWriter(options.Format, w, locale)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "write file: %v", err)
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+
+	if err := writer.Write(header); err != nil {
+		return nil, status.Errorf(codes.Unknown, "write file: %v", err)
+	}
+
+	return &exporter[T]{writer: writer, columns: columns}, nil
+}
+
+func (e *exporter[T]) write(row T) error {
+	values := make([]interface{}, len(e.columns))
+	for i, column := range e.columns {
+		values[i] = column.value(row)
+	}
+
+	if err := e.writer.Write(values); err != nil {
+		return status.Errorf(codes.Unknown, "write file: %v", err)
+	}
+
+	return nil
+}
+
+func (e *exporter[T]) close() error {
+	if err := e.writer.Close(); err != nil {
+		return status.Errorf(codes.Unknown, "write file: %v", err)
+	}
+
+	return nil
+}
+
+// exportRows write every row of the query, scan read the current row of rows
+func exportRows[T any](ctx context.Context, db *sql.DB, query string, paramQueries []interface{}, e *exporter[T], scan func(*sql.Rows) (T, error)) error {
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query export: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := app.ContextError(ctx); err != nil {
+			return err
+		}
+
+		row, err := scan(rows)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		if err := e.write(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", err)
+	}
+
+	return e.close()
+}
+
+// exportDocument is a row of purchase or purchase return export, line is nil when the lines are not exported
+type exportDocument struct {
+	id, branchName, partyID, partyName, code, remark string
+	date, createdAt                                  time.Time
+	price, additionalDiscAmount, totalPrice          float64
+	additionalDiscPercentage                         float32
+	line                                             *exportLine
+}
+
+type exportLine struct {
+	productCode, productName, productUnit string
+	quantity                              int32
+	price, discAmount, totalPrice         float64
+	discPercentage                        float32
+}
+
+// scanExportDocument scan the columns of purchase and purchase return ListQuery, followed by the position and line columns of ExportQuery
+func scanExportDocument(rows *sql.Rows, lines bool) (*exportDocument, error) {
+	var row exportDocument
+	var companyID, branchID, createdBy, updatedBy, cursor string
+	var updatedAt time.Time
+	dest := []interface{}{&row.id, &companyID, &branchID, &row.branchName, &row.partyID, &row.partyName,
+		&row.code, &row.date, &row.remark, &row.price, &row.additionalDiscAmount, &row.additionalDiscPercentage, &row.totalPrice,
+		&row.createdAt, &createdBy, &updatedAt, &updatedBy, &cursor}
+
+	if lines {
+		var position int64
+		row.line = &exportLine{}
+		dest = append(dest, &position, &row.line.productCode, &row.line.productName, &row.line.productUnit, &row.line.quantity,
+			&row.line.price, &row.line.discAmount, &row.line.discPercentage, &row.line.totalPrice)
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return &row, nil
+}
+
+// exportDocumentColumns return the columns of document, party is the supplier of purchase or the purchase code of return
+func exportDocumentColumns(dateName, partyName string, lines bool) []exportColumn[*exportDocument] {
+	columns := []exportColumn[*exportDocument]{
+		{"code", func(r *exportDocument) interface{} { return r.code }},
+		{dateName, func(r *exportDocument) interface{} { return sheet.Date(r.date) }},
+		{"branch", func(r *exportDocument) interface{} { return r.branchName }},
+		{partyName, func(r *exportDocument) interface{} { return r.partyName }},
+		{"remark", func(r *exportDocument) interface{} { return r.remark }},
+		{"price", func(r *exportDocument) interface{} { return r.price }},
+		{"additional_disc_amount", func(r *exportDocument) interface{} { return r.additionalDiscAmount }},
+		{"additional_disc_percentage", func(r *exportDocument) interface{} { return r.additionalDiscPercentage }},
+		{"total_price", func(r *exportDocument) interface{} { return r.totalPrice }},
+		{"created_at", func(r *exportDocument) interface{} { return sheet.DateTime(r.createdAt) }},
+	}
+
+	if !lines {
+		return columns
+	}
+
+	return append(columns,
+		exportColumn[*exportDocument]{"product_code", func(r *exportDocument) interface{} { return r.line.productCode }},
+		exportColumn[*exportDocument]{"product_name", func(r *exportDocument) interface{} { return r.line.productName }},
+		exportColumn[*exportDocument]{"product_unit", func(r *exportDocument) interface{} { return r.line.productUnit }},
+		exportColumn[*exportDocument]{"quantity", func(r *exportDocument) interface{} { return r.line.quantity }},
+		exportColumn[*exportDocument]{"unit_price", func(r *exportDocument) interface{} { return r.line.price }},
+		exportColumn[*exportDocument]{"disc_amount", func(r *exportDocument) interface{} { return r.line.discAmount }},
+		exportColumn[*exportDocument]{"disc_percentage", func(r *exportDocument) interface{} { return r.line.discPercentage }},
+		exportColumn[*exportDocument]{"line_total_price", func(r *exportDocument) interface{} { return r.line.totalPrice }},
+	)
+}
+
+func (u *Purchase) PurchaseExport(in *purchases.PurchaseExportRequest, stream purchases.PurchaseService_PurchaseExportServer) error {
+	ctx := stream.Context()
+	w := newChunkWriter(stream.Send)
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+	scope, err := mBranch.YourScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := in.GetFilter()
+	if filter == nil {
+		filter = &purchases.ListPurchaseRequest{}
+	}
+
+	options := ExportOptions{Format: sheetFormat(in.GetFormat()), Columns: in.GetColumns(), Locale: in.GetLocale()}
+	if err := u.ExportPurchases(ctx, w, filter, in.GetLines(), options, scope); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	return nil
+}
+
+// ExportPurchases write purchases matching the filter and available for the scope into w, one row per purchase line when lines is true.
+// Rows are streamed from the database into w, so the size of export is not limited by memory.
+func (u *Purchase) ExportPurchases(ctx context.Context, w io.Writer, in *purchases.ListPurchaseRequest, lines bool, options ExportOptions, scope *model.BranchScope) error {
+	e, err := newExporter(w, exportDocumentColumns("purchase_date", "supplier", lines), options)
+	if err != nil {
+		return err
+	}
+
+	var purchaseModel model.Purchase
+	query, paramQueries, err := purchaseModel.ExportQuery(ctx, u.Db, in, scope, lines)
+	if err != nil {
+		return err
+	}
+
+	return exportRows(ctx, u.Db, query, paramQueries, e, func(rows *sql.Rows) (*exportDocument, error) {
+		return scanExportDocument(rows, lines)
+	})
+}
+
+func (u *PurchaseReturn) PurchaseReturnExport(in *purchases.PurchaseReturnExportRequest, stream purchases.PurchaseReturnService_PurchaseReturnExportServer) error {
+	ctx := stream.Context()
+	w := newChunkWriter(stream.Send)
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+	scope, err := mBranch.YourScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := in.GetFilter()
+	if filter == nil {
+		filter = &purchases.ListPurchaseReturnRequest{}
+	}
+
+	options := ExportOptions{Format: sheetFormat(in.GetFormat()), Columns: in.GetColumns(), Locale: in.GetLocale()}
+	if err := u.ExportPurchaseReturns(ctx, w, filter, in.GetLines(), options, scope); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	return nil
+}
+
+// ExportPurchaseReturns write purchase returns matching the filter and available for the scope into w,
+// one row per return line when lines is true.
+func (u *PurchaseReturn) ExportPurchaseReturns(ctx context.Context, w io.Writer, in *purchases.ListPurchaseReturnRequest, lines bool, options ExportOptions, scope *model.BranchScope) error {
+	e, err := newExporter(w, exportDocumentColumns("return_date", "purchase_code", lines), options)
+	if err != nil {
+		return err
+	}
+
+	var purchaseReturnModel model.PurchaseReturn
+	query, paramQueries, err := purchaseReturnModel.ExportQuery(ctx, u.Db, in, scope, lines)
+	if err != nil {
+		return err
+	}
+
+	return exportRows(ctx, u.Db, query, paramQueries, e, func(rows *sql.Rows) (*exportDocument, error) {
+		return scanExportDocument(rows, lines)
+	})
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"bufio"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/sheet"
+)
+
+// maxUploadSize limit the size of file uploaded through client stream
+const maxUploadSize = 20 << 20
+
+// chunkSize is the size of file chunk sent through server stream
+const chunkSize = 64 << 10
+
+// chunkWriter send every write as a file chunk of server stream
+type chunkWriter struct {
+	send func(*purchases.FileChunk) error
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+	if err := c.send(&purchases.FileChunk{Chunk: chunk}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// newChunkWriter buffer the writes so each chunk sent is at most chunkSize bytes. The caller must Flush it.
+func newChunkWriter(send func(*purchases.FileChunk) error) *bufio.Writer {
+	return bufio.NewWriterSize(&chunkWriter{send: send}, chunkSize)
+}
+
+func sheetFormat(format purchases.FileFormat) sheet.Format {
+	if format == purchases.FileFormat_XLSX {
+		return sheet.XLSX
+	}
+
+	return sheet.CSV
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// backfillBatchSize is the number of products requested to inventory service at once
+const backfillBatchSize = 100
+
+// BackfillProductSnapshots fill product code, name and unit of the details written before the snapshot was kept.
+// It return the number of details written and the products no longer found in inventory service.
+func (u *Purchase) BackfillProductSnapshots(ctx context.Context) (int64, []string, error) {
+	var total int64
+	var missing []string
+
+	mProduct := model.Product{Client: u.ProductClient}
+	productIds, err := mProduct.ListWithoutSnapshot(ctx, u.Db)
+	if err != nil {
+		return total, missing, err
+	}
+
+	for start := 0; start < len(productIds); start += backfillBatchSize {
+		ids := productIds[start:min(start+backfillBatchSize, len(productIds))]
+		products, err := mProduct.List(ctx, &inventories.ListProductRequest{Ids: ids})
+		if err != nil {
+			return total, missing, err
+		}
+
+		found := make(map[string]bool)
+		tx, err := u.Db.BeginTx(ctx, nil)
+		if err != nil {
+			return total, missing, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		}
+
+		for _, product := range products {
+			found[product.GetProduct().GetId()] = true
+			productModel := model.Product{Pb: product.GetProduct()}
+			affected, err := productModel.BackfillSnapshot(ctx, tx)
+			if err != nil {
+				tx.Rollback()
+				return total, missing, err
+			}
+			total += affected
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return total, missing, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+		}
+
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+	}
+
+	return total, missing, nil
+}
+
+// fillProductSnapshots read code, name and unit from inventory service for the details written before the snapshot
+// was kept and not backfilled yet
+func (u *Purchase) fillProductSnapshots(ctx context.Context, details []*purchases.PurchaseDetail) error {
+	var productIds []string
+	for _, detail := range details {
+		if len(detail.GetProductCode()) == 0 {
+			productIds = append(productIds, detail.GetProductId())
+		}
+	}
+
+	if len(productIds) == 0 {
+		return nil
+	}
+
+	mProduct := model.Product{Client: u.ProductClient}
+	products, err := mProduct.List(ctx, &inventories.ListProductRequest{Ids: productIds})
+	if err != nil {
+		return err
+	}
+
+	productByID := make(map[string]*inventories.Product, len(products))
+	for _, product := range products {
+		productByID[product.GetProduct().GetId()] = product.GetProduct()
+	}
+
+	for _, detail := range details {
+		if product, ok := productByID[detail.GetProductId()]; ok && len(detail.GetProductCode()) == 0 {
+			detail.ProductCode = product.GetCode()
+			detail.ProductName = product.GetName()
+			detail.ProductUnit = product.GetUnit()
+		}
+	}
+
+	return nil
+}
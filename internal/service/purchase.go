@@ -3,13 +3,16 @@ package service
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/mail"
 	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -21,6 +24,8 @@ type Purchase struct {
 	BranchClient  users.BranchServiceClient
 	ProductClient inventories.ProductServiceClient
 	ReceiveClient inventories.ReceiveServiceClient
+	Storage       storage.Storage
+	Mailer        *mail.Mailer
 	purchases.UnimplementedPurchaseServiceServer
 }
 
@@ -41,6 +46,7 @@ func (u *Purchase) PurchaseCreate(ctx context.Context, in *purchases.Purchase) (
 			if detail.GetProductId() == p.Product.GetId() {
 				detail.ProductCode = p.Product.GetCode()
 				detail.ProductName = p.Product.GetName()
+				detail.ProductUnit = p.Product.GetUnit()
 			}
 		}
 
@@ -75,6 +81,7 @@ func (u *Purchase) PurchaseCreate(ctx context.Context, in *purchases.Purchase) (
 		BranchName:               mBranch.Pb.GetName(),
 		Code:                     in.GetCode(),
 		PurchaseDate:             in.GetPurchaseDate(),
+		ExpectedDate:             in.GetExpectedDate(),
 		Supplier:                 in.GetSupplier(),
 		Remark:                   in.GetRemark(),
 		Price:                    sumPrice,
@@ -111,6 +118,10 @@ func (u *Purchase) PurchaseUpdate(ctx context.Context, in *purchases.Purchase) (
 	}
 	purchaseModel.Pb.Id = in.GetId()
 
+	if in.GetVersion() <= 0 {
+		return &purchaseModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid version")
+	}
+
 	// if any return, do update will be blocked
 	{
 		purchaseReturnModel := model.PurchaseReturn{
@@ -138,9 +149,16 @@ func (u *Purchase) PurchaseUpdate(ctx context.Context, in *purchases.Purchase) (
 		return &purchaseModel.Pb, err
 	}
 
+	if purchaseModel.Pb.GetVersion() != in.GetVersion() {
+		return &purchaseModel.Pb, model.ErrVersionConflict
+	}
+
 	// update field of purchase header
 	{
-		if len(in.GetSupplier().Id) > 0 {
+		if len(in.GetSupplier().GetId()) > 0 && in.GetSupplier().GetId() != purchaseModel.Pb.GetSupplier().GetId() {
+			if err := u.validateSupplier(ctx, in.GetSupplier().GetId(), purchaseModel.Pb.GetBranchId()); err != nil {
+				return &purchaseModel.Pb, err
+			}
 			purchaseModel.Pb.GetSupplier().Id = in.GetSupplier().GetId()
 		}
 
@@ -148,6 +166,26 @@ func (u *Purchase) PurchaseUpdate(ctx context.Context, in *purchases.Purchase) (
 			purchaseModel.Pb.PurchaseDate = in.GetPurchaseDate()
 		}
 
+		if len(in.GetExpectedDate()) > 0 {
+			if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetExpectedDate()); err != nil {
+				return &purchaseModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid expected date")
+			}
+			purchaseModel.Pb.ExpectedDate = in.GetExpectedDate()
+		}
+
+		// the new purchase date can also move past the expected date that is kept
+		if len(purchaseModel.Pb.GetExpectedDate()) > 0 {
+			purchaseDate, err := parseDate(purchaseModel.Pb.GetPurchaseDate())
+			if err != nil {
+				return &purchaseModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid date")
+			}
+
+			expectedDate, err := parseDate(purchaseModel.Pb.GetExpectedDate())
+			if err != nil || expectedDate.Before(purchaseDate) {
+				return &purchaseModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid expected date")
+			}
+		}
+
 		if len(in.GetRemark()) > 0 {
 			purchaseModel.Pb.Remark = in.GetRemark()
 		}
@@ -162,6 +200,12 @@ func (u *Purchase) PurchaseUpdate(ctx context.Context, in *purchases.Purchase) (
 		return &purchaseModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
 	}
 
+	// lock the purchase, so the details are not replaced by two requests at the same time
+	if err := purchaseModel.Lock(ctx, tx); err != nil {
+		tx.Rollback()
+		return &purchaseModel.Pb, err
+	}
+
 	//var newDetails []*purchases.PurchaseDetail
 	var productIds []string
 	for _, detail := range in.GetDetails() {
@@ -196,6 +240,7 @@ func (u *Purchase) PurchaseUpdate(ctx context.Context, in *purchases.Purchase) (
 			if detail.GetProductId() == p.Product.GetId() {
 				detail.ProductCode = p.Product.GetCode()
 				detail.ProductName = p.Product.GetName()
+				detail.ProductUnit = p.Product.GetUnit()
 			}
 		}
 
@@ -244,8 +289,9 @@ func (u *Purchase) PurchaseUpdate(ctx context.Context, in *purchases.Purchase) (
 				Pb: purchases.PurchaseDetail{
 					PurchaseId:     purchaseModel.Pb.GetId(),
 					ProductId:      detail.ProductId,
-					ProductCode:    mProduct.Pb.GetCode(),
-					ProductName:    mProduct.Pb.GetName(),
+					ProductCode:    detail.GetProductCode(),
+					ProductName:    detail.GetProductName(),
+					ProductUnit:    detail.GetProductUnit(),
 					Price:          detail.GetPrice(),
 					Quantity:       detail.GetQuantity(),
 					DiscAmount:     detail.GetDiscAmount(),
@@ -324,7 +370,18 @@ func (u *Purchase) PurchaseView(ctx context.Context, in *purchases.Id) (*purchas
 func (u *Purchase) PurchaseList(in *purchases.ListPurchaseRequest, stream purchases.PurchaseService_PurchaseListServer) error {
 	ctx := stream.Context()
 	var purchaseModel model.Purchase
-	query, paramQueries, paginationResponse, err := purchaseModel.ListQuery(ctx, u.Db, in)
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+	scope, err := mBranch.YourScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, paramQueries, paginationResponse, err := purchaseModel.ListQuery(ctx, u.Db, in, scope)
 	if err != nil {
 		return err
 	}
@@ -344,13 +401,13 @@ func (u *Purchase) PurchaseList(in *purchases.ListPurchaseRequest, stream purcha
 
 		var pbPurchase purchases.Purchase
 		var pbSupplier purchases.Supplier
-		var companyID string
+		var companyID, cursor string
 		var createdAt, updatedAt time.Time
 		err = rows.Scan(&pbPurchase.Id, &companyID, &pbPurchase.BranchId, &pbPurchase.BranchName,
 			&pbSupplier.Id, &pbSupplier.Name,
 			&pbPurchase.Code, &pbPurchase.PurchaseDate, &pbPurchase.Remark,
 			&pbPurchase.Price, &pbPurchase.AdditionalDiscAmount, &pbPurchase.AdditionalDiscPercentage, &pbPurchase.TotalPrice,
-			&createdAt, &pbPurchase.CreatedBy, &updatedAt, &pbPurchase.UpdatedBy)
+			&createdAt, &pbPurchase.CreatedBy, &updatedAt, &pbPurchase.UpdatedBy, &cursor)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
@@ -362,6 +419,7 @@ func (u *Purchase) PurchaseList(in *purchases.ListPurchaseRequest, stream purcha
 		res := &purchases.ListPurchaseResponse{
 			Pagination: paginationResponse,
 			Purchase:   &pbPurchase,
+			Cursor:     model.EncodeCursor(cursor),
 		}
 
 		err = stream.Send(res)
@@ -387,36 +445,13 @@ func (u *Purchase) GetOutstandingPurchaseDetails(ctx context.Context, in *purcha
 			return &output, err
 		}
 
-		output.Detail = append(output.Detail, details...)
-	}
-
-	{
-		mProduct := model.Product{
-			Client: u.ProductClient,
-			Pb:     &inventories.Product{},
-		}
-
-		var productIds []string
-		for _, v := range output.Detail {
-			productIds = append(productIds, v.ProductId)
-		}
-
-		inProductList := inventories.ListProductRequest{
-			Ids: productIds,
-		}
-		products, err := mProduct.List(ctx, &inProductList)
-		if err != nil {
+		if err := u.fillProductSnapshots(ctx, details); err != nil {
 			return &output, err
 		}
 
-		for i, d := range output.Detail {
-			for _, v := range products {
-				if v.Product.Id == d.ProductId {
-					output.Detail[i].ProductName = v.Product.Name
-				}
-			}
-		}
+		output.Detail = append(output.Detail, details...)
 	}
+
 	return &output, nil
 }
 
@@ -429,10 +464,22 @@ func (u *Purchase) createValidation(ctx context.Context, in *purchases.Purchase)
 		return []*inventories.ListProductResponse{}, status.Error(codes.InvalidArgument, "Please supply valid supplier")
 	}
 
-	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetPurchaseDate()); err != nil {
+	if err := u.validateSupplier(ctx, in.GetSupplier().GetId(), in.GetBranchId()); err != nil {
+		return []*inventories.ListProductResponse{}, err
+	}
+
+	purchaseDate, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetPurchaseDate())
+	if err != nil {
 		return []*inventories.ListProductResponse{}, status.Error(codes.InvalidArgument, "Please supply valid date")
 	}
 
+	if len(in.GetExpectedDate()) > 0 {
+		expectedDate, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetExpectedDate())
+		if err != nil || expectedDate.Before(purchaseDate) {
+			return []*inventories.ListProductResponse{}, status.Error(codes.InvalidArgument, "Please supply valid expected date")
+		}
+	}
+
 	// validate bulk product by call product grpc
 	var productIds []string
 	for _, detail := range in.GetDetails() {
@@ -462,3 +509,55 @@ func (u *Purchase) createValidation(ctx context.Context, in *purchases.Purchase)
 
 	return products, nil
 }
+
+// validateSupplier check the supplier can be used for a purchase of the branch
+func (u *Purchase) validateSupplier(ctx context.Context, supplierID string, branchID string) error {
+	mSupplier := model.Supplier{Pb: purchases.Supplier{Id: supplierID}}
+	if err := mSupplier.Get(ctx, u.Db); err != nil {
+		return err
+	}
+
+	if err := mSupplier.IsActive(); err != nil {
+		return err
+	}
+
+	if len(mSupplier.Pb.GetBranchIds()) > 0 || len(mSupplier.Pb.GetRegionIds()) > 0 {
+		mBranch := model.Branch{BranchClient: u.BranchClient, Id: branchID}
+		if err := mBranch.Get(ctx); err != nil {
+			return err
+		}
+
+		if !mSupplier.IsAvailable(mBranch.Pb.GetId(), mBranch.Pb.GetRegionId()) {
+			return status.Error(codes.FailedPrecondition, "supplier is not available for the branch")
+		}
+	}
+
+	var settingModel model.PurchaseSetting
+	if err := settingModel.Get(ctx, u.Db); err != nil {
+		return err
+	}
+
+	if settingModel.Pb.GetBlockExpiredDocument() {
+		var documentModel model.SupplierDocument
+		expired, err := documentModel.ExpiredMandatory(ctx, u.Db, supplierID)
+		if err != nil {
+			return err
+		}
+
+		if len(expired) > 0 {
+			return status.Errorf(codes.FailedPrecondition, "supplier has expired mandatory documents: %s", strings.Join(expired, ", "))
+		}
+	}
+
+	return nil
+}
+
+// parseDate parse the date of request, or the date read back by Get that is formatted with time.Time.String()
+func parseDate(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04:05.000Z", value)
+	if err != nil {
+		return time.Parse("2006-01-02 15:04:05 -0700 MST", value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	netmail "net/mail"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/mail"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/printout"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sendTimeout limit the time to deliver the message to the mail transport
+const sendTimeout = 30 * time.Second
+
+// finishTimeout limit the time to record the result of the attempt
+const finishTimeout = 10 * time.Second
+
+const (
+	defaultEmailSubject = `Purchase Order {{.Code}}`
+	defaultEmailBody    = `Dear {{.SupplierName}},
+
+Please find attached our purchase order {{.Code}} dated {{.Date}} with total {{.TotalPrice}}.
+
+Regards,
+{{.CompanyName}}`
+)
+
+// emailData is the data of email template, ex: "Purchase Order {{.Code}}"
+type emailData struct {
+	Code         string
+	Date         string
+	ExpectedDate string
+	SupplierName string
+	BranchName   string
+	CompanyName  string
+	TotalPrice   string
+}
+
+func (u *Purchase) PurchaseEmailSend(ctx context.Context, in *purchases.PurchaseEmailRequest) (*purchases.PurchaseEmail, error) {
+	if len(in.GetPurchaseId()) == 0 {
+		return &purchases.PurchaseEmail{}, status.Error(codes.InvalidArgument, "Please supply valid purchase")
+	}
+
+	return u.sendPurchaseEmail(ctx, in.GetPurchaseId(), in.GetTo(), in.GetCc(), "")
+}
+
+// PurchaseEmailResend send the purchase again to the recipients of previous attempt, with the current version of the purchase
+func (u *Purchase) PurchaseEmailResend(ctx context.Context, in *purchases.Id) (*purchases.PurchaseEmail, error) {
+	var emailModel model.PurchaseEmail
+
+	if len(in.GetId()) == 0 {
+		return &emailModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	emailModel.Pb.Id = in.GetId()
+
+	if err := emailModel.Get(ctx, u.Db); err != nil {
+		return &emailModel.Pb, err
+	}
+
+	return u.sendPurchaseEmail(ctx, emailModel.Pb.GetPurchaseId(), emailModel.Pb.GetTo(), emailModel.Pb.GetCc(), emailModel.Pb.GetId())
+}
+
+func (u *Purchase) PurchaseEmailList(in *purchases.Id, stream purchases.PurchaseService_PurchaseEmailListServer) error {
+	ctx := stream.Context()
+	var purchaseModel model.Purchase
+
+	if len(in.GetId()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	purchaseModel.Pb.Id = in.GetId()
+
+	if err := purchaseModel.Get(ctx, u.Db); err != nil {
+		return err
+	}
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+		Id:           purchaseModel.Pb.GetBranchId(),
+	}
+	if err := mBranch.IsYourBranch(ctx); err != nil {
+		return err
+	}
+
+	var emailModel model.PurchaseEmail
+	list, err := emailModel.List(ctx, u.Db, in.GetId())
+	if err != nil {
+		return err
+	}
+
+	for _, email := range list {
+		err = app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(email)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// sendPurchaseEmail render the purchase and send it to the recipients, or to the contacts of the supplier when there is no recipient.
+// The attempt is recorded before sending, so a failed attempt is kept and can be resent.
+func (u *Purchase) sendPurchaseEmail(ctx context.Context, purchaseID string, to, cc []string, resendOf string) (*purchases.PurchaseEmail, error) {
+	var emailModel model.PurchaseEmail
+
+	purchaseModel, doc, err := u.purchaseDocument(ctx, purchaseID)
+	if err != nil {
+		return &emailModel.Pb, err
+	}
+
+	if len(to) == 0 {
+		var contactModel model.SupplierContact
+		contacts, err := contactModel.List(ctx, u.Db, purchaseModel.Pb.GetSupplier().GetId())
+		if err != nil {
+			return &emailModel.Pb, err
+		}
+
+		for _, contact := range contacts {
+			if len(contact.GetEmail()) > 0 {
+				to = append(to, contact.GetEmail())
+			}
+		}
+
+		if len(to) == 0 {
+			return &emailModel.Pb, status.Error(codes.FailedPrecondition, "supplier has no contact email, please supply the recipient")
+		}
+	}
+
+	for _, address := range append(append([]string{}, to...), cc...) {
+		if _, err := netmail.ParseAddress(address); err != nil {
+			return &emailModel.Pb, status.Errorf(codes.InvalidArgument, "Please supply valid email %s", address)
+		}
+	}
+
+	templateModel, err := documentTemplate(ctx, u.Db, purchases.DocumentType_PURCHASE_ORDER)
+	if err != nil {
+		return &emailModel.Pb, err
+	}
+
+	data := emailData{
+		Code:         purchaseModel.Pb.GetCode(),
+		Date:         printDate(purchaseModel.Pb.GetPurchaseDate()),
+		ExpectedDate: printDate(purchaseModel.Pb.GetExpectedDate()),
+		SupplierName: doc.PartyName,
+		BranchName:   doc.BranchName,
+		CompanyName:  templateModel.Pb.GetCompanyName(),
+		TotalPrice:   printout.FormatAmount(purchaseModel.Pb.GetTotalPrice()),
+	}
+
+	subject, err := executeEmailTemplate(templateModel.Pb.GetEmailSubject(), defaultEmailSubject, data)
+	if err != nil {
+		return &emailModel.Pb, status.Errorf(codes.FailedPrecondition, "invalid email template: %v", err)
+	}
+
+	body, err := executeEmailTemplate(templateModel.Pb.GetEmailBody(), defaultEmailBody, data)
+	if err != nil {
+		return &emailModel.Pb, status.Errorf(codes.FailedPrecondition, "invalid email template: %v", err)
+	}
+
+	// the sent document is always archived, so the attempt show what the supplier received
+	pdf, err := renderPdf(ctx, u.Storage, templateModel, purchaseModel.Pb.GetId(), purchaseModel.Pb.GetCode(),
+		purchaseModel.Pb.GetVersion(), true, doc)
+	if err != nil {
+		return &emailModel.Pb, err
+	}
+
+	emailModel.Pb = purchases.PurchaseEmail{
+		PurchaseId: purchaseModel.Pb.GetId(),
+		To:         to,
+		Cc:         cc,
+		Subject:    strings.Join(strings.Fields(subject), " "),
+		ResendOf:   resendOf,
+		FileKey:    pdf.GetFileKey(),
+	}
+	if err := emailModel.Create(ctx, u.Db); err != nil {
+		return &emailModel.Pb, err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	sendErr := u.Mailer.Send(sendCtx, &mail.Message{
+		To:      to,
+		Cc:      cc,
+		Subject: emailModel.Pb.GetSubject(),
+		Body:    body,
+		Attachments: []mail.Attachment{
+			{Name: pdf.GetFileName(), ContentType: "application/pdf", Data: pdf.GetContent()},
+		},
+	})
+	cancel()
+
+	// the attempt is finished even when the caller has gone, so it is not left in sending status
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancel()
+
+	tx, err := u.Db.BeginTx(finishCtx, nil)
+	if err != nil {
+		return &emailModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = emailModel.Finish(finishCtx, tx, sendErr)
+	if err != nil {
+		tx.Rollback()
+		return &emailModel.Pb, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &emailModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	if sendErr != nil {
+		return &emailModel.Pb, status.Errorf(codes.Unavailable, "send email: %v", sendErr)
+	}
+
+	return &emailModel.Pb, nil
+}
+
+// executeEmailTemplate write the template of the company, or the default template when the company has none
+func executeEmailTemplate(text, defaultText string, data emailData) (string, error) {
+	if len(strings.TrimSpace(text)) == 0 {
+		text = defaultText
+	}
+
+	tmpl, err := template.New("email").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
 	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -20,6 +21,7 @@ type PurchaseReturn struct {
 	RegionClient  users.RegionServiceClient
 	BranchClient  users.BranchServiceClient
 	ReceiveClient inventories.ReceiveServiceClient
+	Storage       storage.Storage
 	purchases.UnimplementedPurchaseReturnServiceServer
 }
 
@@ -83,6 +85,9 @@ func (u *PurchaseReturn) PurchaseReturnCreate(ctx context.Context, in *purchases
 			purchaseQty += p.Quantity
 			if p.GetProductId() == detail.ProductId {
 				detail.Price = p.Price
+				detail.ProductCode = p.ProductCode
+				detail.ProductName = p.ProductName
+				detail.ProductUnit = p.ProductUnit
 				if p.DiscPercentage > 0 {
 					detail.DiscPercentage = p.DiscPercentage
 					detail.DiscAmount = float64(detail.Quantity) * p.GetPrice() * float64(p.DiscPercentage) / 100
@@ -151,6 +156,12 @@ func (u *PurchaseReturn) PurchaseReturnCreate(ctx context.Context, in *purchases
 		return &purchaseReturnModel.Pb, err
 	}
 
+	// check the outstanding again while holding the purchase lock, another return may be committed since the first check
+	if err := u.checkOutstanding(ctx, tx, &mPurchase, nil, in.GetDetails()); err != nil {
+		tx.Rollback()
+		return &purchaseReturnModel.Pb, err
+	}
+
 	err = purchaseReturnModel.Create(ctx, tx)
 	if err != nil {
 		tx.Rollback()
@@ -179,6 +190,17 @@ func (u *PurchaseReturn) PurchaseReturnView(ctx context.Context, in *purchases.I
 		return &purchaseReturnModel.Pb, err
 	}
 
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+		Id:           purchaseReturnModel.Pb.BranchId,
+	}
+	err = mBranch.IsYourBranch(ctx)
+	if err != nil {
+		return &purchaseReturnModel.Pb, err
+	}
+
 	return &purchaseReturnModel.Pb, nil
 }
 
@@ -193,6 +215,10 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 	}
 	purchaseReturnModel.Pb.Id = in.GetId()
 
+	if in.GetVersion() <= 0 {
+		return &purchaseReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid version")
+	}
+
 	// validate not any receiving order yet
 	mReceive := model.Receive{Client: u.ReceiveClient}
 	hasReceive, err := mReceive.HasTransactionByPurchase(ctx, in.Purchase.Id)
@@ -226,6 +252,10 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 		return &purchaseReturnModel.Pb, err
 	}
 
+	if purchaseReturnModel.Pb.GetVersion() != in.GetVersion() {
+		return &purchaseReturnModel.Pb, model.ErrVersionConflict
+	}
+
 	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetReturnDate()); err == nil {
 		purchaseReturnModel.Pb.ReturnDate = in.GetReturnDate()
 	}
@@ -235,6 +265,18 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 		return &purchaseReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
 	}
 
+	// lock the purchase first then the return, the same order as create, so the outstanding is checked against committed returns only
+	if err := u.checkOutstanding(ctx, tx, &mPurchase, &purchaseReturnId, in.GetDetails()); err != nil {
+		tx.Rollback()
+		return &purchaseReturnModel.Pb, err
+	}
+
+	// lock the purchase return, so the details are not replaced by two requests at the same time
+	if err := purchaseReturnModel.Lock(ctx, tx); err != nil {
+		tx.Rollback()
+		return &purchaseReturnModel.Pb, err
+	}
+
 	var sumPrice float64
 	var purchaseQty, returnQty int32
 	// var newDetails []*purchases.PurchaseReturnDetail
@@ -253,6 +295,9 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 				purchaseQty += p.Quantity
 				if p.GetProductId() == detail.ProductId {
 					detail.Price = p.Price
+					detail.ProductCode = p.ProductCode
+					detail.ProductName = p.ProductName
+					detail.ProductUnit = p.ProductUnit
 					if p.DiscPercentage > 0 {
 						detail.DiscPercentage = p.DiscPercentage
 						detail.DiscAmount = float64(detail.Quantity) * p.GetPrice() * float64(p.DiscPercentage) / 100
@@ -295,6 +340,9 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 				purchaseQty += p.Quantity
 				if p.GetProductId() == detail.ProductId {
 					detail.Price = p.Price
+					detail.ProductCode = p.ProductCode
+					detail.ProductName = p.ProductName
+					detail.ProductUnit = p.ProductUnit
 					if p.DiscPercentage > 0 {
 						detail.DiscPercentage = p.DiscPercentage
 						detail.DiscAmount = float64(detail.Quantity) * p.GetPrice() * float64(p.DiscPercentage) / 100
@@ -311,6 +359,9 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 			purchaseReturnDetailModel := model.PurchaseReturnDetail{Pb: purchases.PurchaseReturnDetail{
 				PurchaseReturnId: purchaseReturnModel.Pb.GetId(),
 				ProductId:        detail.GetProductId(),
+				ProductCode:      detail.GetProductCode(),
+				ProductName:      detail.GetProductName(),
+				ProductUnit:      detail.GetProductUnit(),
 				Quantity:         detail.GetQuantity(),
 				Price:            detail.GetPrice(),
 				DiscAmount:       detail.GetDiscAmount(),
@@ -371,7 +422,18 @@ func (u *PurchaseReturn) PurchaseReturnUpdate(ctx context.Context, in *purchases
 func (u *PurchaseReturn) PurchaseReturnList(in *purchases.ListPurchaseReturnRequest, stream purchases.PurchaseReturnService_PurchaseReturnListServer) error {
 	ctx := stream.Context()
 	var purchaseReturnModel model.PurchaseReturn
-	query, paramQueries, paginationResponse, err := purchaseReturnModel.ListQuery(ctx, u.Db, in)
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+	scope, err := mBranch.YourScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, paramQueries, paginationResponse, err := purchaseReturnModel.ListQuery(ctx, u.Db, in, scope)
 	if err != nil {
 		return err
 	}
@@ -390,14 +452,14 @@ func (u *PurchaseReturn) PurchaseReturnList(in *purchases.ListPurchaseReturnRequ
 		}
 
 		var pbPurchaseReturn purchases.PurchaseReturn
-		var companyID string
+		var companyID, cursor string
 		var createdAt, updatedAt time.Time
 		var purchase purchases.Purchase
 		err = rows.Scan(&pbPurchaseReturn.Id, &companyID, &pbPurchaseReturn.BranchId, &pbPurchaseReturn.BranchName,
 			&purchase.Id, &purchase.Code,
 			&pbPurchaseReturn.Code, &pbPurchaseReturn.ReturnDate, &pbPurchaseReturn.Remark,
 			&pbPurchaseReturn.Price, &pbPurchaseReturn.AdditionalDiscAmount, &pbPurchaseReturn.AdditionalDiscPercentage, &pbPurchaseReturn.TotalPrice,
-			&createdAt, &pbPurchaseReturn.CreatedBy, &updatedAt, &pbPurchaseReturn.UpdatedBy)
+			&createdAt, &pbPurchaseReturn.CreatedBy, &updatedAt, &pbPurchaseReturn.UpdatedBy, &cursor)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
@@ -409,6 +471,7 @@ func (u *PurchaseReturn) PurchaseReturnList(in *purchases.ListPurchaseReturnRequ
 		res := &purchases.ListPurchaseReturnResponse{
 			Pagination:     paginationResponse,
 			PurchaseReturn: &pbPurchaseReturn,
+			Cursor:         model.EncodeCursor(cursor),
 		}
 
 		err = stream.Send(res)
@@ -419,6 +482,22 @@ func (u *PurchaseReturn) PurchaseReturnList(in *purchases.ListPurchaseReturnRequ
 	return nil
 }
 
+// checkOutstanding lock the purchase and validate the return details against its outstanding in the transaction
+func (u *PurchaseReturn) checkOutstanding(ctx context.Context, tx *sql.Tx, mPurchase *model.Purchase, purchaseReturnId *string, details []*purchases.PurchaseReturnDetail) error {
+	outstandingPurchaseDetails, err := mPurchase.LockOutstandingDetail(ctx, tx, purchaseReturnId)
+	if err != nil {
+		return err
+	}
+
+	for _, detail := range details {
+		if !u.validateOutstandingDetail(detail, outstandingPurchaseDetails) {
+			return status.Error(codes.FailedPrecondition, "Quantity of the return exceed the outstanding purchase")
+		}
+	}
+
+	return nil
+}
+
 func (u *PurchaseReturn) validateOutstandingDetail(in *purchases.PurchaseReturnDetail, outstanding []*purchases.PurchaseDetail) bool {
 	isValid := false
 	for _, out := range outstanding {
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Purchase) PurchaseSettingView(ctx context.Context, in *purchases.EmptyMessage) (*purchases.PurchaseSetting, error) {
+	var settingModel model.PurchaseSetting
+	if err := settingModel.Get(ctx, u.Db); err != nil {
+		return &settingModel.Pb, err
+	}
+
+	return &settingModel.Pb, nil
+}
+
+// PurchaseSettingUpdate change the fields named in update_mask, the other fields keep their saved value.
+// Without update_mask every field is replaced, a zero price variance threshold is the default threshold.
+func (u *Purchase) PurchaseSettingUpdate(ctx context.Context, in *purchases.PurchaseSetting) (*purchases.PurchaseSetting, error) {
+	var settingModel model.PurchaseSetting
+
+	if in.GetPriceVarianceThreshold() < 0 {
+		return &settingModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid price variance threshold")
+	}
+
+	fields := in.GetUpdateMask()
+	if len(fields) == 0 {
+		fields = []string{"block_expired_document", "price_variance_threshold"}
+	} else if err := settingModel.Get(ctx, u.Db); err != nil {
+		return &settingModel.Pb, err
+	}
+
+	for _, field := range fields {
+		switch field {
+		case "block_expired_document":
+			settingModel.Pb.BlockExpiredDocument = in.GetBlockExpiredDocument()
+		case "price_variance_threshold":
+			settingModel.Pb.PriceVarianceThreshold = in.GetPriceVarianceThreshold()
+			if settingModel.Pb.GetPriceVarianceThreshold() == 0 {
+				settingModel.Pb.PriceVarianceThreshold = model.DefaultPriceVarianceThreshold
+			}
+		default:
+			return &settingModel.Pb, status.Errorf(codes.InvalidArgument, "Please supply valid update mask: unknown field %s", field)
+		}
+	}
+
+	if err := settingModel.Save(ctx, u.Db); err != nil {
+		return &settingModel.Pb, err
+	}
+
+	return &settingModel.Pb, nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Report struct {
+	Db           *sql.DB
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	purchases.UnimplementedReportServiceServer
+}
+
+func (u *Report) SpendReport(ctx context.Context, in *purchases.SpendReportRequest) (*purchases.SpendReport, error) {
+	var output purchases.SpendReport
+
+	dateFrom, dateTo, err := reportDates(in.GetDateFrom(), in.GetDateTo())
+	if err != nil {
+		return &output, err
+	}
+
+	if _, ok := purchases.SpendPeriod_name[int32(in.GetPeriod())]; !ok {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid period")
+	}
+
+	for _, dimension := range in.GetGroupBy() {
+		if _, ok := purchases.SpendDimension_name[int32(dimension)]; !ok {
+			return &output, status.Error(codes.InvalidArgument, "Please supply valid group by")
+		}
+	}
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+	scope, err := mBranch.YourScope(ctx)
+	if err != nil {
+		return &output, err
+	}
+
+	reportModel := model.SpendReport{
+		DateFrom:    dateFrom,
+		DateTo:      dateTo,
+		BranchIds:   in.GetBranchIds(),
+		SupplierIds: in.GetSupplierIds(),
+		GroupBy:     in.GetGroupBy(),
+		Period:      in.GetPeriod(),
+		Scope:       scope,
+	}
+
+	return reportModel.Calculate(ctx, u.Db)
+}
+
+// PriceHistory stream the unit price history of each supplier and product purchased in the period
+func (u *Report) PriceHistory(in *purchases.PriceHistoryRequest, stream purchases.ReportService_PriceHistoryServer) error {
+	ctx := stream.Context()
+
+	reportModel, err := u.priceReport(ctx, in.GetDateFrom(), in.GetDateTo(), in.GetProductId(), in.GetSupplierId())
+	if err != nil {
+		return err
+	}
+
+	return reportModel.History(ctx, u.Db, func(history *purchases.PriceHistory) error {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(history)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// PriceVariance stream the purchase lines of the period whose price deviate from the previous purchase or the moving average
+// by more than the threshold percentage. Without threshold, the threshold of purchase setting is used.
+func (u *Report) PriceVariance(in *purchases.PriceVarianceRequest, stream purchases.ReportService_PriceVarianceServer) error {
+	ctx := stream.Context()
+
+	if _, ok := purchases.PriceVarianceBasis_name[int32(in.GetBasis())]; !ok {
+		return status.Error(codes.InvalidArgument, "Please supply valid basis")
+	}
+
+	if in.GetWindow() < 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid window")
+	}
+
+	if in.GetThresholdPercentage() < 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid threshold percentage")
+	}
+
+	window := int(in.GetWindow())
+	if window == 0 {
+		window = model.DefaultPriceVarianceWindow
+	}
+
+	threshold := in.GetThresholdPercentage()
+	if threshold == 0 {
+		var settingModel model.PurchaseSetting
+		if err := settingModel.Get(ctx, u.Db); err != nil {
+			return err
+		}
+		threshold = settingModel.Pb.GetPriceVarianceThreshold()
+	}
+
+	reportModel, err := u.priceReport(ctx, in.GetDateFrom(), in.GetDateTo(), in.GetProductId(), in.GetSupplierId())
+	if err != nil {
+		return err
+	}
+
+	return reportModel.Variance(ctx, u.Db, in.GetBasis(), window, threshold, func(variance *purchases.PriceVariance) error {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(variance)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+
+		return nil
+	})
+}
+
+func (u *Report) priceReport(ctx context.Context, from, to, productID, supplierID string) (*model.PriceReport, error) {
+	dateFrom, dateTo, err := reportDates(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+	scope, err := mBranch.YourScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PriceReport{
+		DateFrom:   dateFrom,
+		DateTo:     dateTo,
+		ProductId:  productID,
+		SupplierId: supplierID,
+		Scope:      scope,
+	}, nil
+}
+
+func reportDates(from, to string) (time.Time, time.Time, error) {
+	dateFrom, err := time.Parse("2006-01-02T15:04:05.000Z", from)
+	if err != nil {
+		return dateFrom, dateFrom, status.Error(codes.InvalidArgument, "Please supply valid date from")
+	}
+
+	dateTo, err := time.Parse("2006-01-02T15:04:05.000Z", to)
+	if err != nil || dateTo.Before(dateFrom) {
+		return dateFrom, dateTo, status.Error(codes.InvalidArgument, "Please supply valid date to")
+	}
+
+	return dateFrom, dateTo, nil
+}
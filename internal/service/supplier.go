@@ -3,17 +3,26 @@ package service
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
 	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type Supplier struct {
-	Db *sql.DB
+	Db            *sql.DB
+	UserClient    users.UserServiceClient
+	RegionClient  users.RegionServiceClient
+	BranchClient  users.BranchServiceClient
+	ReceiveClient inventories.ReceiveServiceClient
+	Storage       storage.Storage
 	purchases.UnimplementedSupplierServiceServer
 }
 
@@ -21,16 +30,9 @@ func (u *Supplier) SupplierCreate(ctx context.Context, in *purchases.Supplier) (
 	var supplierModel model.Supplier
 	var err error
 
-	if len(in.GetName()) == 0 {
-		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid name")
-	}
-
-	if len(in.GetAddress()) == 0 {
-		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid address")
-	}
-
-	if len(in.GetPhone()) == 0 {
-		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid phone")
+	npwp, err := u.validateSupplier(in)
+	if err != nil {
+		return &supplierModel.Pb, err
 	}
 
 	// code validation
@@ -58,12 +60,25 @@ func (u *Supplier) SupplierCreate(ctx context.Context, in *purchases.Supplier) (
 		Name:    in.GetName(),
 		Address: in.GetAddress(),
 		Phone:   in.GetPhone(),
+		Npwp:    npwp,
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
 	}
-	err = supplierModel.Create(ctx, u.Db)
+
+	err = supplierModel.Create(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &supplierModel.Pb, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
 	return &supplierModel.Pb, nil
 }
 
@@ -76,11 +91,18 @@ func (u *Supplier) SupplierUpdate(ctx context.Context, in *purchases.Supplier) (
 	}
 	supplierModel.Pb.Id = in.GetId()
 
+	if in.GetVersion() <= 0 {
+		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid version")
+	}
+
 	err = supplierModel.Get(ctx, u.Db)
 	if err != nil {
 		return &supplierModel.Pb, err
 	}
 
+	// the update is rejected when the supplier has been changed since the client read it
+	supplierModel.Pb.Version = in.GetVersion()
+
 	if len(in.GetName()) > 0 {
 		supplierModel.Pb.Name = in.GetName()
 	}
@@ -93,11 +115,29 @@ func (u *Supplier) SupplierUpdate(ctx context.Context, in *purchases.Supplier) (
 		supplierModel.Pb.Phone = in.GetPhone()
 	}
 
-	err = supplierModel.Update(ctx, u.Db)
+	if len(in.GetNpwp()) > 0 {
+		supplierModel.Pb.Npwp, err = normalizeNpwp(in.GetNpwp())
+		if err != nil {
+			return &supplierModel.Pb, err
+		}
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = supplierModel.Update(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &supplierModel.Pb, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
 	return &supplierModel.Pb, nil
 }
 
@@ -115,6 +155,45 @@ func (u *Supplier) SupplierView(ctx context.Context, in *purchases.Id) (*purchas
 		return &supplierModel.Pb, err
 	}
 
+	scope, err := u.branchScope(ctx)
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+
+	if !supplierModel.IsVisible(scope) {
+		return &supplierModel.Pb, status.Error(codes.PermissionDenied, "its not your branch")
+	}
+
+	var contactModel model.SupplierContact
+	supplierModel.Pb.Contacts, err = contactModel.List(ctx, u.Db, supplierModel.Pb.GetId())
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+
+	var addressModel model.SupplierAddress
+	supplierModel.Pb.Addresses, err = addressModel.List(ctx, u.Db, supplierModel.Pb.GetId())
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+
+	var bankAccountModel model.SupplierBankAccount
+	supplierModel.Pb.BankAccounts, err = bankAccountModel.List(ctx, u.Db, supplierModel.Pb.GetId())
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+
+	var priceModel model.SupplierPrice
+	supplierModel.Pb.Prices, err = priceModel.List(ctx, u.Db, supplierModel.Pb.GetId())
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+
+	var documentModel model.SupplierDocument
+	supplierModel.Pb.Documents, err = documentModel.List(ctx, u.Db, supplierModel.Pb.GetId())
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+
 	return &supplierModel.Pb, nil
 }
 
@@ -135,19 +214,103 @@ func (u *Supplier) SupplierDelete(ctx context.Context, in *purchases.Id) (*purch
 		return &output, err
 	}
 
-	err = supplierModel.Delete(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &output, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the lock keep a new purchase from referencing the supplier between the check and the delete
+	err = supplierModel.Lock(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &output, err
 	}
 
+	// supplier referenced by purchases is kept for history and only deactivated
+	hasPurchase, err := supplierModel.HasPurchase(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	if hasPurchase {
+		supplierModel.Pb.Status = purchases.SupplierStatus_INACTIVE
+		err = supplierModel.ChangeStatus(ctx, tx)
+	} else {
+		err = supplierModel.Delete(ctx, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
 	output.Boolean = true
 	return &output, nil
 }
 
+func (u *Supplier) SupplierChangeStatus(ctx context.Context, in *purchases.ChangeSupplierStatusRequest) (*purchases.Supplier, error) {
+	var supplierModel model.Supplier
+	var err error
+
+	if len(in.GetId()) == 0 {
+		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	if _, ok := purchases.SupplierStatus_name[int32(in.GetStatus())]; !ok {
+		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid status")
+	}
+
+	if in.GetStatus() == purchases.SupplierStatus_BLOCKED && len(in.GetReason()) == 0 {
+		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid reason of blocking supplier")
+	}
+
+	if in.GetVersion() <= 0 {
+		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid version")
+	}
+	supplierModel.Pb.Id = in.GetId()
+
+	err = supplierModel.Get(ctx, u.Db)
+	if err != nil {
+		return &supplierModel.Pb, err
+	}
+	supplierModel.Pb.Version = in.GetVersion()
+
+	supplierModel.Pb.Status = in.GetStatus()
+	supplierModel.Pb.BlockedReason = in.GetReason()
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = supplierModel.ChangeStatus(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &supplierModel.Pb, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return &supplierModel.Pb, nil
+}
+
 func (u *Supplier) SupplierList(in *purchases.ListSupplierRequest, stream purchases.SupplierService_SupplierListServer) error {
 	ctx := stream.Context()
 	var supplierModel model.Supplier
-	query, paramQueries, paginationResponse, err := supplierModel.ListQuery(ctx, u.Db, in.Pagination)
+	scope, err := u.branchScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, paramQueries, paginationResponse, err := supplierModel.ListQuery(ctx, u.Db, in, scope)
 	if err != nil {
 		return err
 	}
@@ -166,19 +329,22 @@ func (u *Supplier) SupplierList(in *purchases.ListSupplierRequest, stream purcha
 		}
 
 		var pbSupplier purchases.Supplier
-		var companyID string
+		var companyID, supplierStatus, cursor string
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbSupplier.Id, &companyID, &pbSupplier.Code, &pbSupplier.Name, &pbSupplier.Address, &pbSupplier.Phone, &createdAt, &pbSupplier.CreatedBy, &updatedAt, &pbSupplier.UpdatedBy)
+		err = rows.Scan(&pbSupplier.Id, &companyID, &pbSupplier.Code, &pbSupplier.Name, &pbSupplier.Address, &pbSupplier.Phone, &pbSupplier.Npwp,
+			&supplierStatus, &pbSupplier.BlockedReason, &createdAt, &pbSupplier.CreatedBy, &updatedAt, &pbSupplier.UpdatedBy, &cursor)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		pbSupplier.Status = model.SupplierStatusFromString(supplierStatus)
 		pbSupplier.CreatedAt = createdAt.String()
 		pbSupplier.UpdatedAt = updatedAt.String()
 
 		res := &purchases.ListSupplierResponse{
 			Pagination: paginationResponse,
 			Supplier:   &pbSupplier,
+			Cursor:     model.EncodeCursor(cursor),
 		}
 
 		err = stream.Send(res)
@@ -188,3 +354,98 @@ func (u *Supplier) SupplierList(in *purchases.ListSupplierRequest, stream purcha
 	}
 	return nil
 }
+
+// SupplierBranchesUpdate restrict the supplier to the branches and regions. Empty both make the supplier available for all branches.
+func (u *Supplier) SupplierBranchesUpdate(ctx context.Context, in *purchases.SupplierBranchesRequest) (*purchases.Supplier, error) {
+	var supplierModel model.Supplier
+
+	if len(in.GetSupplierId()) == 0 {
+		return &supplierModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+	supplierModel.Pb.Id = in.GetSupplierId()
+
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return &supplierModel.Pb, err
+	}
+
+	for _, branchID := range in.GetBranchIds() {
+		mBranch := model.Branch{BranchClient: u.BranchClient, Id: branchID}
+		if err := mBranch.Get(ctx); err != nil {
+			return &supplierModel.Pb, err
+		}
+	}
+
+	for _, regionID := range in.GetRegionIds() {
+		mRegion := model.Region{RegionClient: u.RegionClient, Id: regionID}
+		if err := mRegion.Get(ctx); err != nil {
+			return &supplierModel.Pb, err
+		}
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	supplierModel.Pb.BranchIds = in.GetBranchIds()
+	supplierModel.Pb.RegionIds = in.GetRegionIds()
+	if err := supplierModel.SaveBranches(ctx, tx); err != nil {
+		tx.Rollback()
+		return &supplierModel.Pb, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &supplierModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return &supplierModel.Pb, nil
+}
+
+// branchScope resolve branches of the user login, nil when the user can access all branches
+func (u *Supplier) branchScope(ctx context.Context) (*model.BranchScope, error) {
+	mBranch := model.Branch{
+		UserClient:   u.UserClient,
+		RegionClient: u.RegionClient,
+		BranchClient: u.BranchClient,
+	}
+
+	return mBranch.YourScope(ctx)
+}
+
+// validateSupplier check mandatory fields of supplier and return the normalized npwp
+func (u *Supplier) validateSupplier(in *purchases.Supplier) (string, error) {
+	if len(in.GetName()) == 0 {
+		return "", status.Error(codes.InvalidArgument, "Please supply valid name")
+	}
+
+	if len(in.GetAddress()) == 0 {
+		return "", status.Error(codes.InvalidArgument, "Please supply valid address")
+	}
+
+	if len(in.GetPhone()) == 0 {
+		return "", status.Error(codes.InvalidArgument, "Please supply valid phone")
+	}
+
+	return normalizeNpwp(in.GetNpwp())
+}
+
+// normalizeNpwp validate tax identification number (NPWP), either 15 digits or 16 digits of NIK based format,
+// and strip the punctuation of format 99.999.999.9-999.999
+func normalizeNpwp(npwp string) (string, error) {
+	if len(npwp) == 0 {
+		return npwp, nil
+	}
+
+	normalized := strings.NewReplacer(".", "", "-", "", " ", "").Replace(npwp)
+	if len(normalized) != 15 && len(normalized) != 16 {
+		return npwp, status.Error(codes.InvalidArgument, "Please supply valid npwp")
+	}
+
+	for _, r := range normalized {
+		if r < '0' || r > '9' {
+			return npwp, status.Error(codes.InvalidArgument, "Please supply valid npwp")
+		}
+	}
+
+	return normalized, nil
+}
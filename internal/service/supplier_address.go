@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Supplier) SupplierAddressCreate(ctx context.Context, in *purchases.SupplierAddress) (*purchases.SupplierAddress, error) {
+	var addressModel model.SupplierAddress
+
+	if len(in.GetSupplierId()) == 0 {
+		return &addressModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	if err := u.validateAddress(in); err != nil {
+		return &addressModel.Pb, err
+	}
+
+	supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return &addressModel.Pb, err
+	}
+
+	addressModel.Pb = purchases.SupplierAddress{
+		SupplierId: in.GetSupplierId(),
+		Type:       in.GetType(),
+		Address:    in.GetAddress(),
+		City:       in.GetCity(),
+		PostalCode: in.GetPostalCode(),
+	}
+	if err := addressModel.Create(ctx, u.Db); err != nil {
+		return &addressModel.Pb, err
+	}
+
+	return &addressModel.Pb, nil
+}
+
+func (u *Supplier) SupplierAddressUpdate(ctx context.Context, in *purchases.SupplierAddress) (*purchases.SupplierAddress, error) {
+	var addressModel model.SupplierAddress
+
+	if len(in.GetId()) == 0 {
+		return &addressModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	addressModel.Pb.Id = in.GetId()
+
+	if err := addressModel.Get(ctx, u.Db); err != nil {
+		return &addressModel.Pb, err
+	}
+
+	// BILLING is the zero value of the enum, it can not be told apart from an omitted type
+	if in.GetType() != purchases.SupplierAddressType_BILLING {
+		addressModel.Pb.Type = in.GetType()
+	}
+
+	if len(in.GetAddress()) > 0 {
+		addressModel.Pb.Address = in.GetAddress()
+	}
+
+	if len(in.GetCity()) > 0 {
+		addressModel.Pb.City = in.GetCity()
+	}
+
+	if len(in.GetPostalCode()) > 0 {
+		addressModel.Pb.PostalCode = in.GetPostalCode()
+	}
+
+	if err := u.validateAddress(&addressModel.Pb); err != nil {
+		return &addressModel.Pb, err
+	}
+
+	if err := addressModel.Update(ctx, u.Db); err != nil {
+		return &addressModel.Pb, err
+	}
+
+	return &addressModel.Pb, nil
+}
+
+func (u *Supplier) SupplierAddressDelete(ctx context.Context, in *purchases.Id) (*purchases.MyBoolean, error) {
+	var output purchases.MyBoolean
+	output.Boolean = false
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	addressModel := model.SupplierAddress{Pb: purchases.SupplierAddress{Id: in.GetId()}}
+	if err := addressModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	if err := addressModel.Delete(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+func (u *Supplier) validateAddress(in *purchases.SupplierAddress) error {
+	if _, ok := purchases.SupplierAddressType_name[int32(in.GetType())]; !ok {
+		return status.Error(codes.InvalidArgument, "Please supply valid address type")
+	}
+
+	if len(in.GetAddress()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid address")
+	}
+
+	if len(in.GetCity()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid city")
+	}
+
+	return nil
+}
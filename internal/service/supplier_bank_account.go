@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Supplier) SupplierBankAccountCreate(ctx context.Context, in *purchases.SupplierBankAccount) (*purchases.SupplierBankAccount, error) {
+	var bankAccountModel model.SupplierBankAccount
+
+	if len(in.GetSupplierId()) == 0 {
+		return &bankAccountModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	if err := u.validateBankAccount(in); err != nil {
+		return &bankAccountModel.Pb, err
+	}
+
+	supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return &bankAccountModel.Pb, err
+	}
+
+	bankAccountModel.Pb = purchases.SupplierBankAccount{
+		SupplierId:    in.GetSupplierId(),
+		BankName:      in.GetBankName(),
+		AccountNumber: in.GetAccountNumber(),
+		AccountName:   in.GetAccountName(),
+	}
+	if err := bankAccountModel.Create(ctx, u.Db); err != nil {
+		return &bankAccountModel.Pb, err
+	}
+
+	return &bankAccountModel.Pb, nil
+}
+
+// SupplierBankAccountUpdate does not touch the existing account,
+// it requests a replacement that takes effect after confirmation.
+func (u *Supplier) SupplierBankAccountUpdate(ctx context.Context, in *purchases.SupplierBankAccount) (*purchases.SupplierBankAccount, error) {
+	var bankAccountModel model.SupplierBankAccount
+
+	if len(in.GetId()) == 0 {
+		return &bankAccountModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	existing := model.SupplierBankAccount{Pb: purchases.SupplierBankAccount{Id: in.GetId()}}
+	if err := existing.Get(ctx, u.Db); err != nil {
+		return &bankAccountModel.Pb, err
+	}
+
+	if existing.Pb.GetStatus() != purchases.SupplierBankAccountStatus_ACTIVE {
+		return &bankAccountModel.Pb, status.Error(codes.FailedPrecondition, "bank account is still waiting for confirmation")
+	}
+
+	bankAccountModel.Pb = purchases.SupplierBankAccount{
+		SupplierId:    existing.Pb.GetSupplierId(),
+		BankName:      existing.Pb.GetBankName(),
+		AccountNumber: existing.Pb.GetAccountNumber(),
+		AccountName:   existing.Pb.GetAccountName(),
+		ReplaceId:     existing.Pb.GetId(),
+	}
+
+	if len(in.GetBankName()) > 0 {
+		bankAccountModel.Pb.BankName = in.GetBankName()
+	}
+
+	if len(in.GetAccountNumber()) > 0 {
+		bankAccountModel.Pb.AccountNumber = in.GetAccountNumber()
+	}
+
+	if len(in.GetAccountName()) > 0 {
+		bankAccountModel.Pb.AccountName = in.GetAccountName()
+	}
+
+	if err := bankAccountModel.Create(ctx, u.Db); err != nil {
+		return &bankAccountModel.Pb, err
+	}
+
+	return &bankAccountModel.Pb, nil
+}
+
+// SupplierBankAccountDelete cancel a pending request. An active account is not deleted,
+// it requests the removal that takes effect after confirmation.
+func (u *Supplier) SupplierBankAccountDelete(ctx context.Context, in *purchases.Id) (*purchases.MyBoolean, error) {
+	var output purchases.MyBoolean
+	output.Boolean = false
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	bankAccountModel := model.SupplierBankAccount{Pb: purchases.SupplierBankAccount{Id: in.GetId()}}
+	if err := bankAccountModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	if bankAccountModel.Pb.GetStatus() == purchases.SupplierBankAccountStatus_ACTIVE {
+		removalModel := model.SupplierBankAccount{Pb: purchases.SupplierBankAccount{
+			SupplierId:    bankAccountModel.Pb.GetSupplierId(),
+			BankName:      bankAccountModel.Pb.GetBankName(),
+			AccountNumber: bankAccountModel.Pb.GetAccountNumber(),
+			AccountName:   bankAccountModel.Pb.GetAccountName(),
+			ReplaceId:     bankAccountModel.Pb.GetId(),
+			Removal:       true,
+		}}
+		if err := removalModel.Create(ctx, u.Db); err != nil {
+			return &output, err
+		}
+
+		output.Boolean = true
+		return &output, nil
+	}
+
+	if err := bankAccountModel.Delete(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+func (u *Supplier) SupplierBankAccountConfirm(ctx context.Context, in *purchases.Id) (*purchases.SupplierBankAccount, error) {
+	var bankAccountModel model.SupplierBankAccount
+
+	if len(in.GetId()) == 0 {
+		return &bankAccountModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	bankAccountModel.Pb.Id = in.GetId()
+
+	if err := bankAccountModel.Get(ctx, u.Db); err != nil {
+		return &bankAccountModel.Pb, err
+	}
+
+	// the requester can not confirm their own bank account change
+	if bankAccountModel.Pb.GetRequestedBy() == ctx.Value(app.Ctx("userID")).(string) {
+		return &bankAccountModel.Pb, status.Error(codes.PermissionDenied, "bank account must be confirmed by another user")
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &bankAccountModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = bankAccountModel.Confirm(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &bankAccountModel.Pb, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &bankAccountModel.Pb, status.Error(codes.Internal, "failed commit transaction")
+	}
+
+	return &bankAccountModel.Pb, nil
+}
+
+func (u *Supplier) validateBankAccount(in *purchases.SupplierBankAccount) error {
+	if len(in.GetBankName()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid bank name")
+	}
+
+	if len(in.GetAccountNumber()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid account number")
+	}
+
+	if len(in.GetAccountName()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid account name")
+	}
+
+	return nil
+}
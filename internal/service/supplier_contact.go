@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"net/mail"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Supplier) SupplierContactCreate(ctx context.Context, in *purchases.SupplierContact) (*purchases.SupplierContact, error) {
+	var contactModel model.SupplierContact
+
+	if len(in.GetSupplierId()) == 0 {
+		return &contactModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	if err := u.validateContact(in); err != nil {
+		return &contactModel.Pb, err
+	}
+
+	supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return &contactModel.Pb, err
+	}
+
+	contactModel.Pb = purchases.SupplierContact{
+		SupplierId: in.GetSupplierId(),
+		Name:       in.GetName(),
+		Role:       in.GetRole(),
+		Email:      in.GetEmail(),
+		Phone:      in.GetPhone(),
+	}
+	if err := contactModel.Create(ctx, u.Db); err != nil {
+		return &contactModel.Pb, err
+	}
+
+	return &contactModel.Pb, nil
+}
+
+func (u *Supplier) SupplierContactUpdate(ctx context.Context, in *purchases.SupplierContact) (*purchases.SupplierContact, error) {
+	var contactModel model.SupplierContact
+
+	if len(in.GetId()) == 0 {
+		return &contactModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	contactModel.Pb.Id = in.GetId()
+
+	if err := contactModel.Get(ctx, u.Db); err != nil {
+		return &contactModel.Pb, err
+	}
+
+	if len(in.GetName()) > 0 {
+		contactModel.Pb.Name = in.GetName()
+	}
+
+	if len(in.GetRole()) > 0 {
+		contactModel.Pb.Role = in.GetRole()
+	}
+
+	if len(in.GetEmail()) > 0 {
+		contactModel.Pb.Email = in.GetEmail()
+	}
+
+	if len(in.GetPhone()) > 0 {
+		contactModel.Pb.Phone = in.GetPhone()
+	}
+
+	if err := u.validateContact(&contactModel.Pb); err != nil {
+		return &contactModel.Pb, err
+	}
+
+	if err := contactModel.Update(ctx, u.Db); err != nil {
+		return &contactModel.Pb, err
+	}
+
+	return &contactModel.Pb, nil
+}
+
+func (u *Supplier) SupplierContactDelete(ctx context.Context, in *purchases.Id) (*purchases.MyBoolean, error) {
+	var output purchases.MyBoolean
+	output.Boolean = false
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	contactModel := model.SupplierContact{Pb: purchases.SupplierContact{Id: in.GetId()}}
+	if err := contactModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	if err := contactModel.Delete(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+func (u *Supplier) validateContact(in *purchases.SupplierContact) error {
+	if len(in.GetName()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid name")
+	}
+
+	if len(in.GetEmail()) == 0 && len(in.GetPhone()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply email or phone")
+	}
+
+	if len(in.GetEmail()) > 0 {
+		if _, err := mail.ParseAddress(in.GetEmail()); err != nil {
+			return status.Error(codes.InvalidArgument, "Please supply valid email")
+		}
+	}
+
+	return nil
+}
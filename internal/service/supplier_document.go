@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupplierDocumentCreate receive the document in the first message and the file in the chunks
+func (u *Supplier) SupplierDocumentCreate(stream purchases.SupplierService_SupplierDocumentCreateServer) error {
+	ctx := stream.Context()
+	var documentModel model.SupplierDocument
+	var file bytes.Buffer
+	var in *purchases.SupplierDocument
+
+	for {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot receive stream request: %v", err)
+		}
+
+		if in == nil {
+			in = req.GetDocument()
+		}
+
+		if file.Len()+len(req.GetChunk()) > maxUploadSize {
+			return status.Errorf(codes.ResourceExhausted, "file is too large, max %d bytes", maxUploadSize)
+		}
+		file.Write(req.GetChunk())
+	}
+
+	if len(in.GetSupplierId()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	if err := u.validateDocument(in); err != nil {
+		return err
+	}
+
+	if len(in.GetFileName()) == 0 || file.Len() == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid file")
+	}
+
+	supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return err
+	}
+
+	documentModel.Pb = purchases.SupplierDocument{
+		SupplierId:  in.GetSupplierId(),
+		Type:        in.GetType(),
+		Number:      in.GetNumber(),
+		IssuedDate:  in.GetIssuedDate(),
+		ExpiryDate:  in.GetExpiryDate(),
+		Mandatory:   in.GetMandatory(),
+		FileName:    in.GetFileName(),
+		ContentType: in.GetContentType(),
+	}
+	documentModel.NewFileKey(ctx.Value(app.Ctx("companyID")).(string))
+
+	size, err := u.Storage.Put(ctx, documentModel.FileKey, &file)
+	if err != nil {
+		return status.Errorf(codes.Internal, "store supplier document: %v", err)
+	}
+	documentModel.Pb.FileSize = size
+
+	if err := documentModel.Create(ctx, u.Db); err != nil {
+		u.Storage.Delete(ctx, documentModel.FileKey)
+		return err
+	}
+
+	return stream.SendAndClose(&documentModel.Pb)
+}
+
+// SupplierDocumentUpdate change the document data, the file is not replaceable. Upload new document instead.
+func (u *Supplier) SupplierDocumentUpdate(ctx context.Context, in *purchases.SupplierDocument) (*purchases.SupplierDocument, error) {
+	var documentModel model.SupplierDocument
+
+	if len(in.GetId()) == 0 {
+		return &documentModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	documentModel.Pb.Id = in.GetId()
+
+	if err := documentModel.Get(ctx, u.Db); err != nil {
+		return &documentModel.Pb, err
+	}
+
+	if err := u.validateDocument(in); err != nil {
+		return &documentModel.Pb, err
+	}
+
+	documentModel.Pb.Type = in.GetType()
+	documentModel.Pb.Number = in.GetNumber()
+	documentModel.Pb.IssuedDate = in.GetIssuedDate()
+	documentModel.Pb.ExpiryDate = in.GetExpiryDate()
+	documentModel.Pb.Mandatory = in.GetMandatory()
+
+	if err := documentModel.Update(ctx, u.Db); err != nil {
+		return &documentModel.Pb, err
+	}
+
+	return &documentModel.Pb, nil
+}
+
+func (u *Supplier) SupplierDocumentDelete(ctx context.Context, in *purchases.Id) (*purchases.MyBoolean, error) {
+	var output purchases.MyBoolean
+	output.Boolean = false
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	documentModel := model.SupplierDocument{Pb: purchases.SupplierDocument{Id: in.GetId()}}
+	if err := documentModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	if err := documentModel.Delete(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	if err := u.Storage.Delete(ctx, documentModel.FileKey); err != nil {
+		return &output, status.Errorf(codes.Internal, "delete supplier document file: %v", err)
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+func (u *Supplier) SupplierDocumentDownload(in *purchases.Id, stream purchases.SupplierService_SupplierDocumentDownloadServer) error {
+	ctx := stream.Context()
+
+	if len(in.GetId()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	documentModel := model.SupplierDocument{Pb: purchases.SupplierDocument{Id: in.GetId()}}
+	if err := documentModel.Get(ctx, u.Db); err != nil {
+		return err
+	}
+
+	file, err := u.Storage.Get(ctx, documentModel.FileKey)
+	if err == storage.ErrNotFound {
+		return status.Error(codes.NotFound, "supplier document file not found")
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "open supplier document file: %v", err)
+	}
+	defer file.Close()
+
+	w := newChunkWriter(stream.Send)
+	if _, err := io.Copy(w, file); err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	return nil
+}
+
+// SupplierDocumentExpiring list documents already expired or expiring within the days
+func (u *Supplier) SupplierDocumentExpiring(in *purchases.ExpiringDocumentRequest, stream purchases.SupplierService_SupplierDocumentExpiringServer) error {
+	ctx := stream.Context()
+
+	if in.GetDays() < 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid days")
+	}
+
+	var documentModel model.SupplierDocument
+	list, err := documentModel.ListExpiring(ctx, u.Db, int(in.GetDays()))
+	if err != nil {
+		return err
+	}
+
+	for _, document := range list {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(document)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (u *Supplier) validateDocument(in *purchases.SupplierDocument) error {
+	if _, ok := purchases.SupplierDocumentType_name[int32(in.GetType())]; !ok {
+		return status.Error(codes.InvalidArgument, "Please supply valid type")
+	}
+
+	if len(in.GetNumber()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid number")
+	}
+
+	issuedDate, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetIssuedDate())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Please supply valid issued date")
+	}
+
+	if len(in.GetExpiryDate()) > 0 {
+		expiryDate, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetExpiryDate())
+		if err != nil || expiryDate.Before(issuedDate) {
+			return status.Error(codes.InvalidArgument, "Please supply valid expiry date")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"github.com/jacky-htg/purchase-service/internal/sheet"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// supplierColumns is the header of supplier import file, only code and name are required
+var supplierColumns = []string{"code", "name", "address", "phone", "npwp", "status", "blocked_reason"}
+
+func (u *Supplier) SupplierImport(stream purchases.SupplierService_SupplierImportServer) error {
+	ctx := stream.Context()
+	var format purchases.FileFormat
+	var dryRun bool
+	var file bytes.Buffer
+	first := true
+
+	for {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot receive stream request: %v", err)
+		}
+
+		if first {
+			format = req.GetFormat()
+			dryRun = req.GetDryRun()
+			first = false
+		}
+
+		if file.Len()+len(req.GetChunk()) > maxUploadSize {
+			return status.Errorf(codes.ResourceExhausted, "file is too large, max %d bytes", maxUploadSize)
+		}
+		file.Write(req.GetChunk())
+	}
+
+	if file.Len() == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid file")
+	}
+
+	output, err := u.ImportSuppliers(ctx, sheetFormat(format), &file, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(output)
+}
+
+// ImportSuppliers create or update suppliers by code from the rows of the file.
+// Invalid rows are reported and skipped, so the valid ones are still imported.
+// On dry run the rows are only validated.
+func (u *Supplier) ImportSuppliers(ctx context.Context, format sheet.Format, r io.Reader, dryRun bool) (*purchases.SupplierImportResponse, error) {
+	output := &purchases.SupplierImportResponse{DryRun: dryRun}
+
+	reader, err := sheet.NewReader(format, r)
+	if err != nil {
+		return output, status.Errorf(codes.InvalidArgument, "read file: %v", err)
+	}
+
+	row, err := reader.Read()
+	if err != nil {
+		return output, status.Error(codes.InvalidArgument, "Please supply valid file header")
+	}
+
+	header := sheet.Header(row)
+	for _, column := range []string{"code", "name"} {
+		if _, ok := header[column]; !ok {
+			return output, status.Errorf(codes.InvalidArgument, "missing column %s", column)
+		}
+	}
+
+	rowByCode := make(map[string]int)
+	for rowNumber := 2; ; rowNumber++ {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return output, err
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		output.Total++
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return output, status.Errorf(codes.InvalidArgument, "read file: %v", err)
+			}
+			u.importError(output, int32(rowNumber), "", err.Error())
+			continue
+		}
+
+		code := sheet.Value(header, row, "code")
+		if previous, ok := rowByCode[code]; ok && len(code) > 0 {
+			u.importError(output, int32(rowNumber), code, fmt.Sprintf("duplicate code with row %d", previous))
+			continue
+		}
+		rowByCode[code] = rowNumber
+
+		created, err := u.importSupplier(ctx, header, row, dryRun)
+		if err != nil {
+			u.importError(output, int32(rowNumber), code, status.Convert(err).Message())
+			continue
+		}
+
+		if created {
+			output.Created++
+		} else {
+			output.Updated++
+		}
+	}
+
+	return output, nil
+}
+
+// importSupplier upsert single row and return true when the supplier is new
+func (u *Supplier) importSupplier(ctx context.Context, header map[string]int, row []string, dryRun bool) (bool, error) {
+	in := purchases.Supplier{
+		Code:    sheet.Value(header, row, "code"),
+		Name:    sheet.Value(header, row, "name"),
+		Address: sheet.Value(header, row, "address"),
+		Phone:   sheet.Value(header, row, "phone"),
+		Npwp:    sheet.Value(header, row, "npwp"),
+	}
+
+	if len(in.GetCode()) == 0 {
+		return false, status.Error(codes.InvalidArgument, "Please supply valid code")
+	}
+
+	npwp, err := u.validateSupplier(&in)
+	if err != nil {
+		return false, err
+	}
+
+	supplierStatus, blockedReason, hasStatus, err := importSupplierStatus(header, row)
+	if err != nil {
+		return false, err
+	}
+
+	supplierModel := model.Supplier{}
+	supplierModel.Pb.Code = in.GetCode()
+	err = supplierModel.GetByCode(ctx, u.Db)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() != codes.NotFound {
+			return false, err
+		}
+	}
+
+	created := len(supplierModel.Pb.GetId()) == 0
+	if created {
+		supplierModel.Pb = purchases.Supplier{
+			Code:    in.GetCode(),
+			Name:    in.GetName(),
+			Address: in.GetAddress(),
+			Phone:   in.GetPhone(),
+			Npwp:    npwp,
+		}
+	} else {
+		supplierModel.Pb.Name = in.GetName()
+		if _, ok := header["address"]; ok {
+			supplierModel.Pb.Address = in.GetAddress()
+		}
+		if _, ok := header["phone"]; ok {
+			supplierModel.Pb.Phone = in.GetPhone()
+		}
+		if _, ok := header["npwp"]; ok {
+			supplierModel.Pb.Npwp = npwp
+		}
+	}
+
+	if dryRun {
+		return created, nil
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return created, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	if created {
+		err = supplierModel.Create(ctx, tx)
+	} else {
+		err = supplierModel.Update(ctx, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return created, err
+	}
+
+	// the status is changed the same way as SupplierChangeStatus, so it is audited and the blocked reason is kept
+	if hasStatus && (supplierStatus != supplierModel.Pb.GetStatus() ||
+		(supplierStatus == purchases.SupplierStatus_BLOCKED && blockedReason != supplierModel.Pb.GetBlockedReason())) {
+		supplierModel.Pb.Status = supplierStatus
+		supplierModel.Pb.BlockedReason = blockedReason
+		err = supplierModel.ChangeStatus(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return created, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return created, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return created, nil
+}
+
+// importSupplierStatus return the status and blocked reason of the row, hasStatus is false when the status is empty
+// so the status of existing supplier is kept. Blocked status require the reason.
+func importSupplierStatus(header map[string]int, row []string) (supplierStatus purchases.SupplierStatus, blockedReason string, hasStatus bool, err error) {
+	value := strings.TrimSpace(sheet.Value(header, row, "status"))
+	if len(value) == 0 {
+		return supplierStatus, blockedReason, false, nil
+	}
+
+	statusValue, ok := purchases.SupplierStatus_value[strings.ToUpper(value)]
+	if !ok {
+		return supplierStatus, blockedReason, false, status.Error(codes.InvalidArgument, "Please supply valid status")
+	}
+	supplierStatus = purchases.SupplierStatus(statusValue)
+
+	if supplierStatus == purchases.SupplierStatus_BLOCKED {
+		blockedReason = strings.TrimSpace(sheet.Value(header, row, "blocked_reason"))
+		if len(blockedReason) == 0 {
+			return supplierStatus, blockedReason, false, status.Error(codes.InvalidArgument, "Please supply valid reason of blocking supplier")
+		}
+	}
+
+	return supplierStatus, blockedReason, true, nil
+}
+
+func (u *Supplier) importError(output *purchases.SupplierImportResponse, row int32, code string, message string) {
+	output.Failed++
+	output.Errors = append(output.Errors, &purchases.ImportError{
+		Row:     row,
+		Code:    code,
+		Message: message,
+	})
+}
+
+func (u *Supplier) SupplierExport(in *purchases.SupplierExportRequest, stream purchases.SupplierService_SupplierExportServer) error {
+	ctx := stream.Context()
+	w := newChunkWriter(stream.Send)
+
+	scope, err := u.branchScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := &purchases.ListSupplierRequest{
+		Pagination: &purchases.Pagination{Search: in.GetSearch()},
+		Statuses:   in.GetStatuses(),
+	}
+	options := ExportOptions{Format: sheetFormat(in.GetFormat()), Columns: in.GetColumns(), Locale: in.GetLocale()}
+	err = u.ExportSuppliers(ctx, w, filter, options, scope)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	return nil
+}
+
+// supplierExportColumns is the columns of supplier export, they are the columns of supplierColumns
+// so the file exported with all columns can be imported back by ImportSuppliers.
+var supplierExportColumns = []exportColumn[*purchases.Supplier]{
+	{"code", func(r *purchases.Supplier) interface{} { return r.GetCode() }},
+	{"name", func(r *purchases.Supplier) interface{} { return r.GetName() }},
+	{"address", func(r *purchases.Supplier) interface{} { return r.GetAddress() }},
+	{"phone", func(r *purchases.Supplier) interface{} { return r.GetPhone() }},
+	{"npwp", func(r *purchases.Supplier) interface{} { return r.GetNpwp() }},
+	{"status", func(r *purchases.Supplier) interface{} { return strings.ToLower(r.GetStatus().String()) }},
+	{"blocked_reason", func(r *purchases.Supplier) interface{} { return r.GetBlockedReason() }},
+}
+
+// ExportSuppliers write suppliers matching the filter and available for the scope into w.
+func (u *Supplier) ExportSuppliers(ctx context.Context, w io.Writer, in *purchases.ListSupplierRequest, options ExportOptions, scope *model.BranchScope) error {
+	e, err := newExporter(w, supplierExportColumns, options)
+	if err != nil {
+		return err
+	}
+
+	var supplierModel model.Supplier
+	in.Pagination = &purchases.Pagination{Search: in.GetPagination().GetSearch(), Sorts: []*purchases.SortField{{Field: "code"}}, CountMode: purchases.Pagination_NONE}
+	query, paramQueries, _, err := supplierModel.ListQuery(ctx, u.Db, in, scope)
+	if err != nil {
+		return err
+	}
+
+	return exportRows(ctx, u.Db, query, paramQueries, e, func(rows *sql.Rows) (*purchases.Supplier, error) {
+		var pbSupplier purchases.Supplier
+		var companyID, supplierStatus, cursor string
+		var createdAt, updatedAt time.Time
+		err := rows.Scan(&pbSupplier.Id, &companyID, &pbSupplier.Code, &pbSupplier.Name, &pbSupplier.Address, &pbSupplier.Phone, &pbSupplier.Npwp,
+			&supplierStatus, &pbSupplier.BlockedReason, &createdAt, &pbSupplier.CreatedBy, &updatedAt, &pbSupplier.UpdatedBy, &cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		pbSupplier.Status = model.SupplierStatusFromString(supplierStatus)
+		return &pbSupplier, nil
+	})
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Supplier) SupplierDuplicates(in *purchases.SupplierDuplicateRequest, stream purchases.SupplierService_SupplierDuplicatesServer) error {
+	ctx := stream.Context()
+
+	if len(in.GetSupplierId()) > 0 {
+		supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+		if err := supplierModel.Get(ctx, u.Db); err != nil {
+			return err
+		}
+	}
+
+	duplicateModel := model.SupplierDuplicate{SupplierId: in.GetSupplierId()}
+	list, err := duplicateModel.Find(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	for _, duplicate := range list {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(duplicate)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (u *Supplier) SupplierMerge(ctx context.Context, in *purchases.MergeSupplierRequest) (*purchases.SupplierMerge, error) {
+	var mergeModel model.SupplierMerge
+
+	if len(in.GetSupplierId()) == 0 {
+		return &mergeModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	if len(in.GetDuplicateId()) == 0 || in.GetDuplicateId() == in.GetSupplierId() {
+		return &mergeModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid duplicate")
+	}
+
+	for _, id := range []string{in.GetSupplierId(), in.GetDuplicateId()} {
+		supplierModel := model.Supplier{Pb: purchases.Supplier{Id: id}}
+		if err := supplierModel.Get(ctx, u.Db); err != nil {
+			return &mergeModel.Pb, err
+		}
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &mergeModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	mergeModel.Pb = purchases.SupplierMerge{
+		SupplierId:       in.GetSupplierId(),
+		MergedSupplierId: in.GetDuplicateId(),
+	}
+	err = mergeModel.Merge(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &mergeModel.Pb, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &mergeModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return &mergeModel.Pb, nil
+}
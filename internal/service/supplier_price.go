@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Supplier) SupplierPriceCreate(ctx context.Context, in *purchases.SupplierPrice) (*purchases.SupplierPrice, error) {
+	var priceModel model.SupplierPrice
+
+	if len(in.GetSupplierId()) == 0 {
+		return &priceModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	if len(in.GetProductId()) == 0 {
+		return &priceModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product")
+	}
+
+	if in.GetPrice() <= 0 {
+		return &priceModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid price")
+	}
+
+	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetValidFrom()); err != nil {
+		return &priceModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid date")
+	}
+
+	supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return &priceModel.Pb, err
+	}
+
+	priceModel.Pb = purchases.SupplierPrice{
+		SupplierId: in.GetSupplierId(),
+		ProductId:  in.GetProductId(),
+		Price:      in.GetPrice(),
+		ValidFrom:  in.GetValidFrom(),
+	}
+	if err := priceModel.Create(ctx, u.Db); err != nil {
+		return &priceModel.Pb, err
+	}
+
+	return &priceModel.Pb, nil
+}
+
+func (u *Supplier) SupplierPriceDelete(ctx context.Context, in *purchases.Id) (*purchases.MyBoolean, error) {
+	var output purchases.MyBoolean
+	output.Boolean = false
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	priceModel := model.SupplierPrice{Pb: purchases.SupplierPrice{Id: in.GetId()}}
+	if err := priceModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	if err := priceModel.Delete(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
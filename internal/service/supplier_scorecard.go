@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/purchase-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Supplier) SupplierScorecard(ctx context.Context, in *purchases.SupplierScorecardRequest) (*purchases.SupplierScorecard, error) {
+	var output purchases.SupplierScorecard
+
+	if len(in.GetSupplierId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid supplier")
+	}
+
+	scorecardModel, err := u.scorecardModel(in)
+	if err != nil {
+		return &output, err
+	}
+
+	supplierModel := model.Supplier{Pb: purchases.Supplier{Id: in.GetSupplierId()}}
+	if err := supplierModel.Get(ctx, u.Db); err != nil {
+		return &output, err
+	}
+
+	scorecardModel.SupplierId = in.GetSupplierId()
+	list, err := scorecardModel.Calculate(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	if len(list) == 0 {
+		// no purchase in the period
+		output.Supplier = &supplierModel.Pb
+		output.DateFrom = scorecardModel.DateFrom.String()
+		output.DateTo = scorecardModel.DateTo.String()
+		return &output, nil
+	}
+
+	list[0].Supplier = &supplierModel.Pb
+	return list[0], nil
+}
+
+func (u *Supplier) SupplierRanking(in *purchases.SupplierScorecardRequest, stream purchases.SupplierService_SupplierRankingServer) error {
+	ctx := stream.Context()
+	scorecardModel, err := u.scorecardModel(in)
+	if err != nil {
+		return err
+	}
+
+	list, err := scorecardModel.Calculate(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	for _, scorecard := range list {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(scorecard)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (u *Supplier) scorecardModel(in *purchases.SupplierScorecardRequest) (model.SupplierScorecard, error) {
+	scorecardModel := model.SupplierScorecard{
+		Receive: model.Receive{Client: u.ReceiveClient},
+	}
+
+	dateFrom, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetDateFrom())
+	if err != nil {
+		return scorecardModel, status.Error(codes.InvalidArgument, "Please supply valid date from")
+	}
+
+	dateTo, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetDateTo())
+	if err != nil || dateTo.Before(dateFrom) {
+		return scorecardModel, status.Error(codes.InvalidArgument, "Please supply valid date to")
+	}
+
+	scorecardModel.DateFrom = dateFrom
+	scorecardModel.DateTo = dateTo
+
+	return scorecardModel, nil
+}
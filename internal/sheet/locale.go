@@ -0,0 +1,87 @@
+package sheet
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale format numbers and dates of written file
+type Locale struct {
+	Decimal    string
+	Thousands  string
+	DateLayout string
+}
+
+// DefaultLocale is machine readable, without thousands separator and with ISO date
+var DefaultLocale = Locale{Decimal: ".", DateLayout: "2006-01-02"}
+
+// locales map lower cased language tag, or its language part, to the locale
+var locales = map[string]Locale{
+	"en":    {Decimal: ".", Thousands: ",", DateLayout: "02/01/2006"},
+	"en-us": {Decimal: ".", Thousands: ",", DateLayout: "01/02/2006"},
+	"id":    {Decimal: ",", Thousands: ".", DateLayout: "02/01/2006"},
+	"de":    {Decimal: ",", Thousands: ".", DateLayout: "02.01.2006"},
+	"nl":    {Decimal: ",", Thousands: ".", DateLayout: "02-01-2006"},
+	"fr":    {Decimal: ",", Thousands: " ", DateLayout: "02/01/2006"},
+	"ja":    {Decimal: ".", Thousands: ",", DateLayout: "2006/01/02"},
+	"zh":    {Decimal: ".", Thousands: ",", DateLayout: "2006/01/02"},
+}
+
+// ParseLocale return the locale of language tag, ex: id-ID. Empty tag is the DefaultLocale.
+func ParseLocale(tag string) (Locale, error) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if len(tag) == 0 {
+		return DefaultLocale, nil
+	}
+
+	if locale, ok := locales[tag]; ok {
+		return locale, nil
+	}
+
+	if locale, ok := locales[strings.SplitN(tag, "-", 2)[0]]; ok {
+		return locale, nil
+	}
+
+	return DefaultLocale, fmt.Errorf("unsupported locale %s", tag)
+}
+
+// Number format v with fixed decimals, ex: 1.234.567,50 for id
+func (l Locale) Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i+1:]
+	}
+
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.Thousands)
+		}
+		b.WriteRune(digit)
+	}
+
+	if len(fraction) > 0 {
+		b.WriteString(l.Decimal)
+		b.WriteString(fraction)
+	}
+
+	return b.String()
+}
+
+// Date format the date part of t
+func (l Locale) Date(t time.Time) string {
+	return t.Format(l.DateLayout)
+}
+
+// DateTime format t up to minute
+func (l Locale) DateTime(t time.Time) string {
+	return t.Format(l.DateLayout + " 15:04")
+}
@@ -0,0 +1,186 @@
+package sheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of spreadsheet file
+type Format int
+
+const (
+	CSV Format = iota
+	XLSX
+)
+
+// Reader read rows of the first sheet
+type Reader interface {
+	// Read return next row, or io.EOF when there is no more row
+	Read() ([]string, error)
+}
+
+// Writer write rows into single sheet. Close must be called to flush the file.
+type Writer interface {
+	Write(row []string) error
+	Close() error
+}
+
+// Cell is a value of row. Number cell hold a plain decimal number, XLSX write it as number.
+type Cell struct {
+	Value  string
+	Number bool
+}
+
+// CellWriter is implemented by the writer keeping the type of cells
+type CellWriter interface {
+	WriteCells(row []Cell) error
+}
+
+// Date is a value written as date without time
+type Date time.Time
+
+// DateTime is a value written as date and time
+type DateTime time.Time
+
+// NewReader create reader of the format. XLSX need random access to the zip, so r is fully read into memory.
+func NewReader(format Format, r io.Reader) (Reader, error) {
+	switch format {
+	case CSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return reader, nil
+	case XLSX:
+		return newXlsxReader(r)
+	}
+
+	return nil, fmt.Errorf("unsupported format %d", format)
+}
+
+// NewWriter create writer of the format. Rows are streamed into w, not kept in memory.
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case XLSX:
+		return newXlsxWriter(w)
+	}
+
+	return nil, fmt.Errorf("unsupported format %d", format)
+}
+
+// Header map lower cased column name to its index
+func Header(row []string) map[string]int {
+	header := make(map[string]int)
+	for i, name := range row {
+		header[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	return header
+}
+
+// Value return column value of the row by header name, or empty string when the column does not exist
+func Value(header map[string]int, row []string, name string) string {
+	i, ok := header[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+
+	return strings.TrimSpace(row[i])
+}
+
+// ValueWriter write rows of typed values. Numbers and dates are formatted by the locale,
+// except XLSX numbers which are kept as number so the spreadsheet format them by the locale of its user.
+type ValueWriter struct {
+	w      Writer
+	locale Locale
+}
+
+// NewValueWriter create writer of the format, rows are streamed into w
+func NewValueWriter(format Format, w io.Writer, locale Locale) (*ValueWriter, error) {
+	writer, err := NewWriter(format, w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValueWriter{w: writer, locale: locale}, nil
+}
+
+// Write a row, the value is string, int, int32, int64, float32, float64, Date, DateTime or nil.
+// Floats are written with 2 decimals.
+func (v *ValueWriter) Write(row []interface{}) error {
+	cells := make([]Cell, len(row))
+	for i, value := range row {
+		cell, err := v.cell(value)
+		if err != nil {
+			return err
+		}
+		cells[i] = cell
+	}
+
+	if cw, ok := v.w.(CellWriter); ok {
+		return cw.WriteCells(cells)
+	}
+
+	values := make([]string, len(cells))
+	for i, cell := range cells {
+		values[i] = cell.Value
+	}
+
+	return v.w.Write(values)
+}
+
+func (v *ValueWriter) Close() error {
+	return v.w.Close()
+}
+
+func (v *ValueWriter) cell(value interface{}) (Cell, error) {
+	_, number := v.w.(CellWriter)
+	switch value := value.(type) {
+	case nil:
+		return Cell{}, nil
+	case string:
+		return Cell{Value: value}, nil
+	case int:
+		return v.number(float64(value), 0, number), nil
+	case int32:
+		return v.number(float64(value), 0, number), nil
+	case int64:
+		return v.number(float64(value), 0, number), nil
+	case float32:
+		return v.number(float64(value), 2, number), nil
+	case float64:
+		return v.number(value, 2, number), nil
+	case Date:
+		return Cell{Value: v.locale.Date(time.Time(value))}, nil
+	case DateTime:
+		return Cell{Value: v.locale.DateTime(time.Time(value))}, nil
+	}
+
+	return Cell{}, fmt.Errorf("unsupported value %T", value)
+}
+
+func (v *ValueWriter) number(value float64, decimals int, number bool) Cell {
+	if number {
+		return Cell{Value: strconv.FormatFloat(value, 'f', decimals, 64), Number: true}
+	}
+
+	return Cell{Value: v.locale.Number(value, decimals)}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(row []string) error {
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,276 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/lib/pq"
+)
+
+// Setting is the session setting read by the row level security policies
+const Setting = "app.company_id"
+
+// BypassSetting is the session setting read by the policies of the tables that maintenance jobs clean up across companies
+const BypassSetting = "app.bypass_rls"
+
+type bypassKey struct{}
+
+// Bypass return the context whose statements pass the bypass policies, it must only be used by maintenance jobs.
+// Tables without bypass policy still only show the rows of the company of the context.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// errTenantChanged is returned when a transaction is used by context of another company
+var errTenantChanged = errors.New("tenant can not be changed in the middle of transaction")
+
+// Open connect to postgres with the connection wrapper. Every statement run with the company of its context
+// as the tenant, so the row level security policies only show the rows of the company.
+// Context without company see nothing of the tenant tables.
+func Open() (*sql.DB, error) {
+	sslMode := os.Getenv("POSTGRES_SSLMODE")
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_USER"),
+		os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_DB"), sslMode)
+
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(&Connector{Connector: connector})
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Connector wrap the connections of the driver connector
+type Connector struct {
+	driver.Connector
+}
+
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenantConn{Conn: conn}, nil
+}
+
+// tenantConn set the tenant of the session before running the statement, when it differ from the last one set.
+// The setting is session wide, so it is set outside of transaction and kept on rollback.
+type tenantConn struct {
+	driver.Conn
+	companyID string
+	bypass    bool
+	hasTenant bool
+	inTx      bool
+}
+
+func (c *tenantConn) setTenant(ctx context.Context) error {
+	companyID, _ := ctx.Value(app.Ctx("companyID")).(string)
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	if c.hasTenant && companyID == c.companyID && bypass == c.bypass {
+		return nil
+	}
+
+	if c.inTx {
+		return errTenantChanged
+	}
+
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return errors.New("driver connection does not support ExecContext")
+	}
+
+	bypassValue := ""
+	if bypass {
+		bypassValue = "on"
+	}
+
+	c.hasTenant = false
+	_, err := execer.ExecContext(ctx, `SELECT set_config($1, $2, false), set_config($3, $4, false)`, []driver.NamedValue{
+		{Ordinal: 1, Value: Setting},
+		{Ordinal: 2, Value: companyID},
+		{Ordinal: 3, Value: BypassSetting},
+		{Ordinal: 4, Value: bypassValue},
+	})
+	if err != nil {
+		return fmt.Errorf("set tenant: %v", err)
+	}
+
+	c.companyID = companyID
+	c.bypass = bypass
+	c.hasTenant = true
+
+	return nil
+}
+
+func (c *tenantConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tenantConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenantStmt{Stmt: stmt, conn: c}, nil
+}
+
+func (c *tenantConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	if err := c.setTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *tenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	if err := c.setTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *tenantConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx set the tenant from the context of transaction, the statements of the transaction must use the same company
+func (c *tenantConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.setTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.inTx = true
+	return &tenantTx{Tx: tx, conn: c}, nil
+}
+
+func (c *tenantConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c *tenantConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *tenantConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+
+	return true
+}
+
+func (c *tenantConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
+
+type tenantTx struct {
+	driver.Tx
+	conn *tenantConn
+}
+
+func (t *tenantTx) Commit() error {
+	t.conn.inTx = false
+	return t.Tx.Commit()
+}
+
+func (t *tenantTx) Rollback() error {
+	t.conn.inTx = false
+	return t.Tx.Rollback()
+}
+
+// tenantStmt set the tenant with the context of each execution, the statement may be prepared by another context
+type tenantStmt struct {
+	driver.Stmt
+	conn *tenantConn
+}
+
+func (s *tenantStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.conn.setTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+
+	return s.Stmt.Exec(values(args))
+}
+
+func (s *tenantStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.conn.setTenant(ctx); err != nil {
+		return nil, err
+	}
+
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, args)
+	}
+
+	return s.Stmt.Query(values(args))
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	list := make([]driver.Value, len(args))
+	for i, arg := range args {
+		list[i] = arg.Value
+	}
+
+	return list
+}
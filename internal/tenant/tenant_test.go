@@ -0,0 +1,251 @@
+package tenant_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/purchase-service/internal/schema"
+	"github.com/jacky-htg/purchase-service/internal/tenant"
+)
+
+// company is the rows of one tenant, one row in every tenant table
+type company struct {
+	ctx        context.Context
+	id         string
+	supplierID string
+	purchaseID string
+	returnID   string
+}
+
+// testDB connect to the database of POSTGRES_* env and migrate it, the test is skipped without POSTGRES_HOST
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+
+	db, err := tenant.Open()
+	if err != nil {
+		t.Fatalf("connecting to db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := schema.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+// seed insert the rows of a new company with the context of the company, so they pass its policies
+func seed(t *testing.T, db *sql.DB) *company {
+	t.Helper()
+
+	userID := uuid.New().String()
+	c := &company{
+		id:         uuid.New().String(),
+		supplierID: uuid.New().String(),
+		purchaseID: uuid.New().String(),
+		returnID:   uuid.New().String(),
+	}
+	c.ctx = context.WithValue(context.Background(), app.Ctx("companyID"), c.id)
+	c.ctx = context.WithValue(c.ctx, app.Ctx("userID"), userID)
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO suppliers (id, company_id, code, name, address, phone, created_by, updated_by)
+			VALUES ($1, $2, 'SUP-TEST', $3, '', '', $4, $4)`, []interface{}{c.supplierID, c.id, "test " + c.supplierID[:8], userID}},
+		{`INSERT INTO supplier_contacts (id, supplier_id, name, role, email, phone, created_by, updated_by)
+			VALUES ($1, $2, 'Test', 'sales', 'test@example.com', '', $3, $3)`, []interface{}{uuid.New().String(), c.supplierID, userID}},
+		{`INSERT INTO supplier_addresses (id, supplier_id, type, address, city, postal_code, created_by, updated_by)
+			VALUES ($1, $2, 'billing', '', '', '', $3, $3)`, []interface{}{uuid.New().String(), c.supplierID, userID}},
+		{`INSERT INTO supplier_bank_accounts (id, supplier_id, bank_name, account_number, account_name, requested_by)
+			VALUES ($1, $2, 'Test', '123', 'Test', $3)`, []interface{}{uuid.New().String(), c.supplierID, userID}},
+		{`INSERT INTO supplier_prices (id, supplier_id, product_id, price, valid_from, created_by)
+			VALUES ($1, $2, $3, 100, '2024-08-01', $4)`, []interface{}{uuid.New().String(), c.supplierID, uuid.New().String(), userID}},
+		{`INSERT INTO supplier_documents (id, supplier_id, type, number, issued_date, file_key, file_name, content_type, file_size, created_by, updated_by)
+			VALUES ($1, $2, 'contract', '1', '2024-08-01', 'test', 'test.pdf', 'application/pdf', 1, $3, $3)`, []interface{}{uuid.New().String(), c.supplierID, userID}},
+		{`INSERT INTO supplier_branches (supplier_id, branch_id) VALUES ($1, $2)`, []interface{}{c.supplierID, uuid.New().String()}},
+		{`INSERT INTO supplier_regions (supplier_id, region_id) VALUES ($1, $2)`, []interface{}{c.supplierID, uuid.New().String()}},
+		{`INSERT INTO purchases (id, company_id, branch_id, branch_name, supplier_id, code, purchase_date, remark, price, total_price, created_by, updated_by)
+			VALUES ($1, $2, $3, 'Test', $4, 'PO-TEST', '2024-08-01', '', 100, 100, $5, $5)`, []interface{}{c.purchaseID, c.id, uuid.New().String(), c.supplierID, userID}},
+		{`INSERT INTO purchase_details (id, purchase_id, product_id, price, quantity, total_price)
+			VALUES ($1, $2, $3, 100, 1, 100)`, []interface{}{uuid.New().String(), c.purchaseID, uuid.New().String()}},
+		{`INSERT INTO purchase_emails (id, purchase_id, recipients, subject, status, created_by)
+			VALUES ($1, $2, '{test@example.com}', 'Test', 'sent', $3)`, []interface{}{uuid.New().String(), c.purchaseID, userID}},
+		{`INSERT INTO purchase_returns (id, company_id, branch_id, branch_name, purchase_id, code, return_date, remark, price, total_price, created_by, updated_by)
+			VALUES ($1, $2, $3, 'Test', $4, 'PR-TEST', '2024-08-02', '', 100, 100, $5, $5)`, []interface{}{c.returnID, c.id, uuid.New().String(), c.purchaseID, userID}},
+		{`INSERT INTO purchase_return_details (id, purchase_return_id, product_id, price, quantity, total_price)
+			VALUES ($1, $2, $3, 100, 1, 100)`, []interface{}{uuid.New().String(), c.returnID, uuid.New().String()}},
+		{`INSERT INTO supplier_merges (id, company_id, supplier_id, merged_supplier_id, merged_code, merged_name, purchase_count, created_by)
+			VALUES ($1, $2, $3, $4, 'SUP-MERGED', 'merged', 0, $5)`, []interface{}{uuid.New().String(), c.id, c.supplierID, uuid.New().String(), userID}},
+		{`INSERT INTO purchase_settings (company_id, updated_by) VALUES ($1, $2)`, []interface{}{c.id, userID}},
+		{`INSERT INTO document_templates (company_id, document_type, updated_by) VALUES ($1, 'purchase', $2)`, []interface{}{c.id, userID}},
+		{`INSERT INTO audit_logs (id, company_id, entity, entity_id, action, actor)
+			VALUES ($1, $2, 'purchase', $3, 'create', $4)`, []interface{}{uuid.New().String(), c.id, c.purchaseID, userID}},
+		{`INSERT INTO idempotency_keys (company_id, key, method, request_hash, expires_at)
+			VALUES ($1, 'test', '/test', repeat('0', 64), NOW() + INTERVAL '1 hour')`, []interface{}{c.id}},
+	}
+	for _, s := range statements {
+		if _, err := db.ExecContext(c.ctx, s.query, s.args...); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, s := range []struct {
+			query string
+			id    string
+		}{
+			{`DELETE FROM purchase_returns WHERE id = $1`, c.returnID},
+			{`DELETE FROM purchase_emails WHERE purchase_id = $1`, c.purchaseID},
+			{`DELETE FROM purchases WHERE id = $1`, c.purchaseID},
+			{`DELETE FROM suppliers WHERE id = $1`, c.supplierID},
+			{`DELETE FROM supplier_merges WHERE company_id = $1`, c.id},
+			{`DELETE FROM purchase_settings WHERE company_id = $1`, c.id},
+			{`DELETE FROM document_templates WHERE company_id = $1`, c.id},
+			{`DELETE FROM idempotency_keys WHERE company_id = $1`, c.id},
+		} {
+			if _, err := db.ExecContext(c.ctx, s.query, s.id); err != nil {
+				t.Errorf("cleanup: %v", err)
+			}
+		}
+	})
+
+	return c
+}
+
+// tenantTables is the query counting the rows of a company in every tenant table, id return the row id it is filtered by.
+// TestTenantTablesCovered check it list every table with row level security.
+var tenantTables = []struct {
+	table string
+	query string
+	id    func(*company) string
+}{
+	{"suppliers", `SELECT COUNT(*) FROM suppliers WHERE id = $1`, supplierID},
+	{"supplier_contacts", `SELECT COUNT(*) FROM supplier_contacts WHERE supplier_id = $1`, supplierID},
+	{"supplier_addresses", `SELECT COUNT(*) FROM supplier_addresses WHERE supplier_id = $1`, supplierID},
+	{"supplier_bank_accounts", `SELECT COUNT(*) FROM supplier_bank_accounts WHERE supplier_id = $1`, supplierID},
+	{"supplier_prices", `SELECT COUNT(*) FROM supplier_prices WHERE supplier_id = $1`, supplierID},
+	{"supplier_documents", `SELECT COUNT(*) FROM supplier_documents WHERE supplier_id = $1`, supplierID},
+	{"supplier_branches", `SELECT COUNT(*) FROM supplier_branches WHERE supplier_id = $1`, supplierID},
+	{"supplier_regions", `SELECT COUNT(*) FROM supplier_regions WHERE supplier_id = $1`, supplierID},
+	{"purchases", `SELECT COUNT(*) FROM purchases WHERE id = $1`, purchaseID},
+	{"purchase_details", `SELECT COUNT(*) FROM purchase_details WHERE purchase_id = $1`, purchaseID},
+	{"purchase_emails", `SELECT COUNT(*) FROM purchase_emails WHERE purchase_id = $1`, purchaseID},
+	{"purchase_returns", `SELECT COUNT(*) FROM purchase_returns WHERE id = $1`, returnID},
+	{"purchase_return_details", `SELECT COUNT(*) FROM purchase_return_details WHERE purchase_return_id = $1`, returnID},
+	{"supplier_merges", `SELECT COUNT(*) FROM supplier_merges WHERE company_id = $1`, companyID},
+	{"purchase_settings", `SELECT COUNT(*) FROM purchase_settings WHERE company_id = $1`, companyID},
+	{"document_templates", `SELECT COUNT(*) FROM document_templates WHERE company_id = $1`, companyID},
+	{"audit_logs", `SELECT COUNT(*) FROM audit_logs WHERE company_id = $1`, companyID},
+	{"idempotency_keys", `SELECT COUNT(*) FROM idempotency_keys WHERE company_id = $1`, companyID},
+}
+
+func companyID(c *company) string  { return c.id }
+func supplierID(c *company) string { return c.supplierID }
+func purchaseID(c *company) string { return c.purchaseID }
+func returnID(c *company) string   { return c.returnID }
+
+func count(ctx context.Context, t *testing.T, db *sql.DB, query string, id string) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRowContext(ctx, query, id).Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+
+	return n
+}
+
+// TestIsolation read the rows of company B through the connection of company A, none of them must be visible
+func TestIsolation(t *testing.T) {
+	db := testDB(t)
+	a := seed(t, db)
+	b := seed(t, db)
+
+	noCompany := context.WithValue(context.Background(), app.Ctx("companyID"), "")
+
+	for _, tt := range tenantTables {
+		if n := count(a.ctx, t, db, tt.query, tt.id(a)); n != 1 {
+			t.Errorf("%s: company A see %d of its rows, want 1", tt.table, n)
+		}
+
+		if n := count(a.ctx, t, db, tt.query, tt.id(b)); n != 0 {
+			t.Errorf("%s: company A see %d rows of company B", tt.table, n)
+		}
+
+		if n := count(noCompany, t, db, tt.query, tt.id(b)); n != 0 {
+			t.Errorf("%s: context without company see %d rows of company B", tt.table, n)
+		}
+	}
+}
+
+// TestTenantTablesCovered check every table of the schema has row level security and is checked by TestIsolation
+func TestTenantTablesCovered(t *testing.T) {
+	db := testDB(t)
+
+	rows, err := db.Query(`
+		SELECT relname, relrowsecurity AND relforcerowsecurity FROM pg_class
+		WHERE relkind = 'r' AND relnamespace = current_schema()::regnamespace AND relname <> 'darwin_migrations'
+	`)
+	if err != nil {
+		t.Fatalf("query tables: %v", err)
+	}
+	defer rows.Close()
+
+	covered := make(map[string]bool)
+	for _, tt := range tenantTables {
+		covered[tt.table] = true
+	}
+
+	for rows.Next() {
+		var table string
+		var secured bool
+		if err := rows.Scan(&table, &secured); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+
+		if !secured {
+			t.Errorf("%s: row level security is not enabled and forced", table)
+		}
+
+		if !covered[table] {
+			t.Errorf("%s: not checked by TestIsolation", table)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+}
+
+// TestBypass delete the idempotency keys of another company through the bypass, the way Purge does
+func TestBypass(t *testing.T) {
+	db := testDB(t)
+	a := seed(t, db)
+	b := seed(t, db)
+
+	bypass := tenant.Bypass(a.ctx)
+	if n := count(bypass, t, db, `SELECT COUNT(*) FROM idempotency_keys WHERE company_id = $1`, b.id); n != 1 {
+		t.Errorf("bypass see %d idempotency keys of company B, want 1", n)
+	}
+
+	if n := count(bypass, t, db, `SELECT COUNT(*) FROM suppliers WHERE id = $1`, b.supplierID); n != 0 {
+		t.Errorf("bypass see %d suppliers of company B", n)
+	}
+
+	if _, err := db.ExecContext(bypass, `DELETE FROM idempotency_keys WHERE company_id = $1`, b.id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if n := count(b.ctx, t, db, `SELECT COUNT(*) FROM idempotency_keys WHERE company_id = $1`, b.id); n != 0 {
+		t.Errorf("company B still has %d idempotency keys", n)
+	}
+}
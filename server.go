@@ -1,21 +1,37 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
-	"github.com/jacky-htg/erp-pkg/db/postgres"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
 	"github.com/jacky-htg/purchase-service/internal/config"
+	"github.com/jacky-htg/purchase-service/internal/mail"
 	"github.com/jacky-htg/purchase-service/internal/middleware"
+	"github.com/jacky-htg/purchase-service/internal/model"
 	"github.com/jacky-htg/purchase-service/internal/route"
+	"github.com/jacky-htg/purchase-service/internal/storage"
+	"github.com/jacky-htg/purchase-service/internal/tenant"
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-const defaultPort = "8002"
+const (
+	defaultPort           = "8002"
+	defaultStorageDir     = "storage"
+	defaultIdempotencyTTL = 24 * time.Hour
+	defaultMailTransport  = "smtp"
+	// interval of logging the hit rate of user cache
+	userCacheStatsInterval = 15 * time.Minute
+)
 
 func main() {
 	// lookup and setup env
@@ -29,10 +45,11 @@ func main() {
 	}
 
 	// init log
+	infoLog := log.New(os.Stdout, "INFO : ", log.LstdFlags|log.Lmicroseconds)
 	log := log.New(os.Stdout, "ERROR : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
 
 	// create postgres database connection
-	db, err := postgres.Open()
+	db, err := tenant.Open()
 	if err != nil {
 		log.Fatalf("connecting to db: %v", err)
 		return
@@ -46,32 +63,127 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	userConn, err := grpc.NewClient(os.Getenv("USER_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("create user service connection: %v", err)
+	}
+	defer userConn.Close()
+
+	inventoryConn, err := grpc.NewClient(os.Getenv("INVENTORY_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("create inventory service connection: %v", err)
+	}
+	defer userConn.Close()
+
+	// key set to verify the token of the caller
+	authKeys, err := middleware.LoadKeySet(os.Getenv("JWT_KEYS_FILE"))
+	if err != nil {
+		log.Fatalf("load jwt key set: %v", err)
+	}
+
+	// responses of user service are cached for USER_CACHE_TTL, ex: 1m, up to USER_CACHE_SIZE entries
+	if ttl := os.Getenv("USER_CACHE_TTL"); ttl != "" {
+		userCacheTTL, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("parse USER_CACHE_TTL: %v", err)
+		}
+
+		userCacheSize, err := strconv.Atoi(os.Getenv("USER_CACHE_SIZE"))
+		if err != nil {
+			log.Fatalf("parse USER_CACHE_SIZE: %v", err)
+		}
+		model.SetUserCache(userCacheTTL, userCacheSize)
+	}
+	go func() {
+		for range time.Tick(userCacheStatsInterval) {
+			stats := model.UserCacheStats()
+			infoLog.Printf("user cache: hits %d, misses %d, size %d, hit rate %.2f", stats.Hits, stats.Misses, stats.Size, stats.HitRate)
+		}
+	}()
+
+	// expvar metrics, including the user_cache stats, are served as JSON on METRICS_ADDR, ex: :9002
+	if metricsAddr := os.Getenv("METRICS_ADDR"); metricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(metricsAddr, expvar.Handler()); err != nil {
+				log.Printf("serve metrics: %v", err)
+			}
+		}()
+	}
+
+	// idempotency key of retried call is kept for IDEMPOTENCY_TTL, ex: 24h
+	idempotencyTTL := defaultIdempotencyTTL
+	if ttl := os.Getenv("IDEMPOTENCY_TTL"); ttl != "" {
+		idempotencyTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("parse IDEMPOTENCY_TTL: %v", err)
+		}
+	}
+
+	// key of call in progress is held for IDEMPOTENCY_LEASE, ex: 1m, then a retry can take it over
+	idempotencyLease := middleware.DefaultIdempotencyLease
+	if lease := os.Getenv("IDEMPOTENCY_LEASE"); lease != "" {
+		idempotencyLease, err = time.ParseDuration(lease)
+		if err != nil {
+			log.Fatalf("parse IDEMPOTENCY_LEASE: %v", err)
+		}
+	}
+
 	mdInterceptor := middleware.Metadata{}
+	authInterceptor := middleware.Auth{
+		Keys:        authKeys,
+		UserClient:  users.NewUserServiceClient(userConn),
+		Permissions: middleware.Permissions,
+	}
+	idempotencyInterceptor := middleware.Idempotency{Db: db, Log: log, TTL: idempotencyTTL, Lease: idempotencyLease}
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := idempotencyInterceptor.Purge(context.Background()); err != nil {
+				log.Printf("purge idempotency keys: %v", err)
+			}
+		}
+	}()
+
 	serverOptions := []grpc.ServerOption{
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			mdInterceptor.Unary(),
+			authInterceptor.Unary(),
+			idempotencyInterceptor.Unary(),
 		)),
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			mdInterceptor.Stream(),
+			authInterceptor.Stream(),
 		)),
 	}
 
 	grpcServer := grpc.NewServer(serverOptions...)
 
-	userConn, err := grpc.NewClient(os.Getenv("USER_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// local blob storage for uploaded files
+	storageDir := os.Getenv("STORAGE_DIR")
+	if storageDir == "" {
+		storageDir = defaultStorageDir
+	}
+	blob, err := storage.NewLocal(storageDir)
 	if err != nil {
-		log.Fatalf("create user service connection: %v", err)
+		log.Fatalf("create storage: %v", err)
 	}
-	defer userConn.Close()
 
-	inventoryConn, err := grpc.NewClient(os.Getenv("INVENTORY_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// mail transport to send documents to suppliers: smtp, file or memory
+	mailTransport := os.Getenv("MAIL_TRANSPORT")
+	if mailTransport == "" {
+		mailTransport = defaultMailTransport
+	}
+	transport, err := mail.NewTransport(mailTransport)
 	if err != nil {
-		log.Fatalf("create inventory service connection: %v", err)
+		log.Fatalf("create mail transport: %v", err)
 	}
-	defer userConn.Close()
+	mailFrom := os.Getenv("MAIL_FROM")
+	if err := mail.ValidateSender(mailFrom); err != nil {
+		log.Fatalf("parse MAIL_FROM: %v", err)
+	}
+	mailer := &mail.Mailer{Transport: transport, From: mailFrom}
 
 	// routing grpc services
-	route.GrpcRoute(grpcServer, db, log, userConn, inventoryConn)
+	route.GrpcRoute(grpcServer, db, log, userConn, inventoryConn, blob, mailer)
 
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %s", err)